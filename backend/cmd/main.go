@@ -2,6 +2,7 @@ package main
 
 import (
 	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/onetime"
 	"digital-library/backend/internal/routes"
 	"digital-library/backend/internal/utils"
 	"digital-library/backend/pkg/database"
@@ -11,6 +12,11 @@ import (
 )
 
 func main() {
+	// Load JWT signing keys
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatal("Failed to load JWT signing keys: ", err)
+	}
+
 	// Initialize database
 	database.ConnectDB()
 	
@@ -49,6 +55,8 @@ func seedData(emailService *email.Service) {
 		"view_loans",
 		"manage_overdue",
 		"verify_email",
+		"lookup_patrons",
+		"manage_categories",
 	}
 	
 	for _, p := range permissions {
@@ -85,11 +93,10 @@ func seedData(emailService *email.Service) {
 	}
 	
 	adminUser := models.User{
-		Username:    "admin",
-		Email:       "admin@library.com",
-		Password:    hashedPassword,
-		IsVerified:  true,
-		VerifyToken: "",
+		Username:   "admin",
+		Email:      "admin@library.com",
+		Password:   hashedPassword,
+		IsVerified: true,
 	}
 	
 	if err := database.DB.FirstOrCreate(&adminUser, models.User{Username: "admin"}).Error; err != nil {
@@ -104,28 +111,27 @@ func seedData(emailService *email.Service) {
 	
 	// Create test user (unverified initially)
 	userPassword, _ := utils.HashPassword("user123")
-	token, err := utils.GenerateVerificationToken()
-	if err != nil {
-		log.Println("Failed to generate verification token:", err)
-		return
-	}
 	
 	testUser := models.User{
-		Username:     "testuser",
-		Email:        "user@library.com",
-		Password:     userPassword,
-		IsVerified:   false,
-		VerifyToken:  token,
-		VerifyExpiry: time.Now().Add(24 * time.Hour),
+		Username:   "testuser",
+		Email:      "user@library.com",
+		Password:   userPassword,
+		IsVerified: false,
 	}
 	
 	if err := database.DB.FirstOrCreate(&testUser, models.User{Username: "testuser"}).Error; err == nil {
 		// Assign user role
 		database.DB.Model(&testUser).Association("Roles").Append(&userRole)
 		
+		token, err := onetime.NewService(database.DB).Issue(testUser.ID, onetime.PurposeVerifyEmail, 24*time.Hour, "")
+		if err != nil {
+			log.Println("Failed to generate verification token:", err)
+			return
+		}
+		
 		// Send verification email for test user
 		go func() {
-			if err := emailService.SendVerificationEmail(testUser.Email, testUser.VerifyToken); err != nil {
+			if err := emailService.SendVerificationEmail(testUser.Email, token); err != nil {
 				log.Printf("Failed to send test user verification: %v", err)
 			}
 		}()
@@ -0,0 +1,172 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidKey is returned for malformed, unknown, expired or revoked keys.
+	ErrInvalidKey = errors.New("invalid or expired API key")
+	// ErrKeyNotFound is returned when revoking a key the user does not own.
+	ErrKeyNotFound = errors.New("API key not found")
+	// ErrScopeNotHeld is returned when a key would be granted a permission
+	// its owner does not have.
+	ErrScopeNotHeld = errors.New("cannot grant a permission you do not hold")
+)
+
+// KeyPrefix marks a string as a library API key, so it can be told apart
+// from a JWT and recognized by secret scanners.
+const KeyPrefix = "dlk_"
+
+// lastUsedInterval limits how often a key's LastUsedAt is written.
+const lastUsedInterval = time.Minute
+
+// Service manages personal API keys. A key has the form
+// dlk_<id>_<secret>; the id part is stored in clear as the lookup prefix,
+// the full key only as a hash.
+type Service struct {
+	db    *gorm.DB
+	authz *authz.Service
+}
+
+func NewService(db *gorm.DB, authzService *authz.Service) *Service {
+	return &Service{db: db, authz: authzService}
+}
+
+// Create issues a key for the user limited to the given scopes, each of which
+// the user must currently hold. The plaintext key is returned only here.
+func (s *Service) Create(userID uint, name string, scopes []string, expiresAt *time.Time) (string, *models.APIKey, error) {
+	held, err := s.authz.Permissions(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if !held.HasAll(scopes...) {
+		return "", nil, ErrScopeNotHeld
+	}
+
+	id, err := randomHex(6)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", nil, err
+	}
+	prefix := KeyPrefix + id
+	plaintext := prefix + "_" + secret
+
+	key := models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   utils.HashToken(plaintext),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.db.Create(&key).Error; err != nil {
+		return "", nil, err
+	}
+	return plaintext, &key, nil
+}
+
+// List returns the user's keys that have not been revoked, newest first.
+func (s *Service) List(userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := s.db.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// Revoke disables one of the user's keys.
+func (s *Service) Revoke(userID, keyID uint) error {
+	result := s.db.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate resolves a presented key to its record and the permissions it
+// grants: the key's scopes that its owner still holds.
+func (s *Service) Authenticate(plaintext string) (*models.APIKey, authz.PermissionSet, error) {
+	prefix, ok := prefixOf(plaintext)
+	if !ok {
+		return nil, nil, ErrInvalidKey
+	}
+
+	var key models.APIKey
+	err := s.db.Where("prefix = ? AND revoked_at IS NULL", prefix).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(utils.HashToken(plaintext))) != 1 {
+		return nil, nil, ErrInvalidKey
+	}
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, nil, ErrInvalidKey
+	}
+
+	held, err := s.authz.Permissions(key.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	granted := authz.PermissionSet{}
+	for _, scope := range key.Scopes {
+		if held.Has(scope) {
+			granted[scope] = true
+		}
+	}
+
+	if key.LastUsedAt == nil || key.LastUsedAt.Before(now.Add(-lastUsedInterval)) {
+		if err := s.db.Model(&key).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	return &key, granted, nil
+}
+
+// IsKey reports whether the credential looks like an API key rather than a JWT.
+func IsKey(credential string) bool {
+	return strings.HasPrefix(credential, KeyPrefix)
+}
+
+func prefixOf(plaintext string) (string, bool) {
+	rest, ok := strings.CutPrefix(plaintext, KeyPrefix)
+	if !ok {
+		return "", false
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return "", false
+	}
+	return KeyPrefix + id, true
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
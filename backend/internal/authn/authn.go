@@ -0,0 +1,65 @@
+package authn
+
+import (
+	"errors"
+
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCredentials is returned when the username or password is wrong.
+// Backends return it for unknown users too, so a chain can try the next one.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator checks a username and password against one credential
+// backend and returns the matching library user with roles loaded.
+type Authenticator interface {
+	Name() string
+	Authenticate(username, password string) (*models.User, error)
+}
+
+// Chain tries each authenticator in order and returns the first success.
+// Backend errors other than ErrInvalidCredentials are returned immediately
+// so an outage is not reported as a wrong password.
+type Chain []Authenticator
+
+func (ch Chain) Authenticate(username, password string) (*models.User, error) {
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	for _, a := range ch {
+		user, err := a.Authenticate(username, password)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			return nil, err
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// PasswordAuthenticator checks the bcrypt password hash stored on models.User.
+type PasswordAuthenticator struct {
+	DB *gorm.DB
+}
+
+func (pa *PasswordAuthenticator) Name() string {
+	return "local"
+}
+
+func (pa *PasswordAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	var user models.User
+	if err := pa.DB.Where("username = ?", username).Preload("Roles").First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if !utils.CheckPasswordHash(password, user.Password) {
+		return nil, ErrInvalidCredentials
+	}
+	return &user, nil
+}
@@ -0,0 +1,203 @@
+package authn
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/provisioning"
+	"github.com/go-ldap/ldap/v3"
+)
+
+type LDAPConfig struct {
+	URL       string // ldap:// or ldaps:// URL of the directory server
+	StartTLS  bool   // upgrade ldap:// connections with StartTLS
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+
+	// BindDN and BindPassword are the service account used to look users up.
+	// Leave empty to search anonymously.
+	BindDN       string
+	BindPassword string
+
+	BaseDN string
+	// UserFilter finds the user entry; %s is replaced by the escaped username.
+	UserFilter string
+
+	UsernameAttribute string // e.g. uid or sAMAccountName
+	EmailAttribute    string // e.g. mail
+	// IDAttribute is a stable identifier that survives renames, e.g.
+	// entryUUID or objectGUID. The entry DN is used when it is missing.
+	IDAttribute    string
+	GroupAttribute string // e.g. memberOf
+}
+
+// Enabled reports whether a directory server is configured.
+func (c LDAPConfig) Enabled() bool {
+	return c.URL != "" && c.BaseDN != ""
+}
+
+// LDAPAuthenticator verifies passwords by binding to an LDAP directory as the
+// user and provisions the matching library user just in time.
+type LDAPAuthenticator struct {
+	config      LDAPConfig
+	provisioner *provisioning.Service
+}
+
+func NewLDAPAuthenticator(cfg LDAPConfig, provisioner *provisioning.Service) *LDAPAuthenticator {
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid=%s)"
+	}
+	if cfg.UsernameAttribute == "" {
+		cfg.UsernameAttribute = "uid"
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+	if cfg.IDAttribute == "" {
+		cfg.IDAttribute = "entryUUID"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &LDAPAuthenticator{config: cfg, provisioner: provisioner}
+}
+
+func (la *LDAPAuthenticator) Name() string {
+	return "ldap"
+}
+
+func (la *LDAPAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	// An empty password would turn the user bind into an anonymous bind,
+	// which many servers accept.
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := la.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if la.config.BindDN != "" {
+		if err := conn.Bind(la.config.BindDN, la.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind: %w", err)
+		}
+	}
+
+	entry, err := la.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap user bind: %w", err)
+	}
+
+	// The entry is known by its stable ID, never by its mail attribute:
+	// whoever can edit the directory must not be able to sign in as a
+	// local account with the same address
+	subject := entry.GetAttributeValue(la.config.IDAttribute)
+	if subject == "" {
+		subject = entry.DN
+	}
+
+	ext := provisioning.ExternalUser{
+		Provider: la.config.URL,
+		Subject:  subject,
+		Username: entry.GetAttributeValue(la.config.UsernameAttribute),
+		Email:    entry.GetAttributeValue(la.config.EmailAttribute),
+		Groups:   groupNames(entry.GetAttributeValues(la.config.GroupAttribute)),
+	}
+	if ext.Email == "" {
+		return nil, fmt.Errorf("ldap entry %s has no %s attribute", entry.DN, la.config.EmailAttribute)
+	}
+
+	return la.provisioner.Provision(ext)
+}
+
+func (la *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	opts := []ldap.DialOpt{}
+	if la.config.TLSConfig != nil {
+		opts = append(opts, ldap.DialWithTLSConfig(la.config.TLSConfig))
+	}
+
+	conn, err := ldap.DialURL(la.config.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %w", err)
+	}
+	conn.SetTimeout(la.config.Timeout)
+
+	if la.config.StartTLS {
+		tlsConfig := la.config.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: hostFromURL(la.config.URL)}
+		}
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (la *LDAPAuthenticator) findUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	request := ldap.NewSearchRequest(
+		la.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(la.config.Timeout.Seconds()), false,
+		strings.ReplaceAll(la.config.UserFilter, "%s", ldap.EscapeFilter(username)),
+		[]string{la.config.UsernameAttribute, la.config.EmailAttribute, la.config.IDAttribute, la.config.GroupAttribute},
+		nil,
+	)
+
+	result, err := conn.Search(request)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, errors.New("ldap user filter matched more than one entry")
+		}
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrInvalidCredentials
+	case 1:
+		return result.Entries[0], nil
+	default:
+		return nil, errors.New("ldap user filter matched more than one entry")
+	}
+}
+
+// groupNames returns each group both as given (usually a DN) and by its
+// first RDN value, so mappings can name either "cn=staff,ou=groups,..." or "staff".
+func groupNames(values []string) []string {
+	names := make([]string, 0, 2*len(values))
+	for _, value := range values {
+		names = append(names, value)
+		dn, err := ldap.ParseDN(value)
+		if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+			continue
+		}
+		names = append(names, dn.RDNs[0].Attributes[0].Value)
+	}
+	return names
+}
+
+func hostFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,119 @@
+package authz
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PermissionSet is the effective set of permission names granted to a user
+// through the roles assigned to them.
+type PermissionSet map[string]bool
+
+// Has reports whether the set contains the permission.
+func (ps PermissionSet) Has(permission string) bool {
+	return ps[permission]
+}
+
+// HasAny reports whether the set contains at least one of the permissions.
+func (ps PermissionSet) HasAny(permissions ...string) bool {
+	for _, p := range permissions {
+		if ps[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAll reports whether the set contains every one of the permissions.
+func (ps PermissionSet) HasAll(permissions ...string) bool {
+	for _, p := range permissions {
+		if !ps[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// Names returns the permission names in the set.
+func (ps PermissionSet) Names() []string {
+	names := make([]string, 0, len(ps))
+	for name := range ps {
+		names = append(names, name)
+	}
+	return names
+}
+
+type cacheEntry struct {
+	permissions PermissionSet
+	expires     time.Time
+}
+
+// Service resolves a user's permissions from user_roles and role_permissions
+// and caches the result per user until it expires or is invalidated.
+type Service struct {
+	db    *gorm.DB
+	ttl   time.Duration
+	mu    sync.RWMutex
+	cache map[uint]cacheEntry
+}
+
+func NewService(db *gorm.DB, ttl time.Duration) *Service {
+	return &Service{
+		db:    db,
+		ttl:   ttl,
+		cache: make(map[uint]cacheEntry),
+	}
+}
+
+// Permissions returns the effective permission set for the user.
+func (s *Service) Permissions(userID uint) (PermissionSet, error) {
+	s.mu.RLock()
+	entry, ok := s.cache[userID]
+	s.mu.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.permissions, nil
+	}
+
+	var names []string
+	err := s.db.Table("permissions").
+		Distinct("permissions.name").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id AND roles.deleted_at IS NULL").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ? AND permissions.deleted_at IS NULL", userID).
+		Pluck("permissions.name", &names).Error
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := make(PermissionSet, len(names))
+	for _, name := range names {
+		permissions[name] = true
+	}
+
+	s.mu.Lock()
+	s.cache[userID] = cacheEntry{permissions: permissions, expires: time.Now().Add(s.ttl)}
+	s.mu.Unlock()
+
+	return permissions, nil
+}
+
+// Invalidate drops the cached permissions of the given users, e.g. after
+// their role assignments change.
+func (s *Service) Invalidate(userIDs ...uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range userIDs {
+		delete(s.cache, id)
+	}
+}
+
+// InvalidateAll drops every cached entry, e.g. after a role's permissions
+// change and any number of users may be affected.
+func (s *Service) InvalidateAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache = make(map[uint]cacheEntry)
+}
@@ -0,0 +1,149 @@
+package authz_test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/testdb"
+	"gorm.io/gorm"
+)
+
+// fixture is a database with a librarian holding the manage_books and
+// manage_loans permissions through one role.
+type fixture struct {
+	db        *gorm.DB
+	librarian models.User
+	role      models.Role
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	db := testdb.Open(t, &models.User{}, &models.Role{}, &models.Permission{})
+
+	role := models.Role{
+		Name:        "librarian",
+		Permissions: []models.Permission{{Name: "manage_books"}, {Name: "manage_loans"}},
+	}
+	if err := db.Create(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	librarian := models.User{Username: "librarian", Email: "librarian@library.com", Password: "hash", Roles: []models.Role{role}}
+	if err := db.Create(&librarian).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &fixture{db: db, librarian: librarian, role: role}
+}
+
+func expectPermissions(t *testing.T, s *authz.Service, userID uint, want ...string) {
+	t.Helper()
+	got, err := s.Permissions(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := got.Names()
+	sort.Strings(names)
+	sort.Strings(want)
+	if len(names) != len(want) {
+		t.Fatalf("permissions = %v, want %v", names, want)
+	}
+	for i := range names {
+		if names[i] != want[i] {
+			t.Fatalf("permissions = %v, want %v", names, want)
+		}
+	}
+}
+
+func TestPermissionsResolveThroughRoles(t *testing.T) {
+	f := newFixture(t)
+	other := models.Role{Name: "desk", Permissions: []models.Permission{{Name: "lookup_patrons"}}}
+	if err := f.db.Create(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := f.db.Model(&f.librarian).Association("Roles").Append(&other); err != nil {
+		t.Fatal(err)
+	}
+	patron := models.User{Username: "patron", Email: "patron@library.com", Password: "hash"}
+	if err := f.db.Create(&patron).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s := authz.NewService(f.db, time.Minute)
+	expectPermissions(t, s, f.librarian.ID, "lookup_patrons", "manage_books", "manage_loans")
+	expectPermissions(t, s, patron.ID)
+}
+
+func TestPermissionsIgnoreDeletedRolesAndPermissions(t *testing.T) {
+	f := newFixture(t)
+	if err := f.db.Where("name = ?", "manage_loans").Delete(&models.Permission{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	s := authz.NewService(f.db, time.Minute)
+	expectPermissions(t, s, f.librarian.ID, "manage_books")
+
+	if err := f.db.Delete(&f.role).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.InvalidateAll()
+	expectPermissions(t, s, f.librarian.ID)
+}
+
+func TestPermissionsAreCachedUntilInvalidated(t *testing.T) {
+	f := newFixture(t)
+	s := authz.NewService(f.db, time.Hour)
+	expectPermissions(t, s, f.librarian.ID, "manage_books", "manage_loans")
+
+	if err := f.db.Model(&f.librarian).Association("Roles").Clear(); err != nil {
+		t.Fatal(err)
+	}
+	expectPermissions(t, s, f.librarian.ID, "manage_books", "manage_loans")
+
+	s.Invalidate(f.librarian.ID)
+	expectPermissions(t, s, f.librarian.ID)
+}
+
+func TestInvalidateAllDropsEveryUser(t *testing.T) {
+	f := newFixture(t)
+	s := authz.NewService(f.db, time.Hour)
+	expectPermissions(t, s, f.librarian.ID, "manage_books", "manage_loans")
+
+	var permission models.Permission
+	if err := f.db.Where("name = ?", "manage_loans").First(&permission).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := f.db.Model(&f.role).Association("Permissions").Delete(&permission); err != nil {
+		t.Fatal(err)
+	}
+	s.Invalidate(f.librarian.ID + 1)
+	expectPermissions(t, s, f.librarian.ID, "manage_books", "manage_loans")
+
+	s.InvalidateAll()
+	expectPermissions(t, s, f.librarian.ID, "manage_books")
+}
+
+func TestCachedPermissionsExpire(t *testing.T) {
+	f := newFixture(t)
+	s := authz.NewService(f.db, 50*time.Millisecond)
+	expectPermissions(t, s, f.librarian.ID, "manage_books", "manage_loans")
+
+	if err := f.db.Model(&f.librarian).Association("Roles").Clear(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	expectPermissions(t, s, f.librarian.ID)
+}
+
+func TestPermissionSetChecks(t *testing.T) {
+	set := authz.PermissionSet{"manage_books": true, "manage_loans": true}
+	if !set.Has("manage_books") || set.Has("manage_users") {
+		t.Error("Has does not match the set")
+	}
+	if !set.HasAny("manage_users", "manage_loans") || set.HasAny("manage_users", "lookup_patrons") {
+		t.Error("HasAny does not match the set")
+	}
+	if !set.HasAll("manage_books", "manage_loans") || set.HasAll("manage_books", "manage_users") {
+		t.Error("HasAll does not match the set")
+	}
+}
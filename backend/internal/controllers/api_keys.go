@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"digital-library/backend/internal/apikeys"
+	"digital-library/backend/internal/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// maxAPIKeyLifetime caps how long a personal API key can stay valid.
+const maxAPIKeyLifetime = 365 * 24 * time.Hour
+
+// CreateAPIKey issues a personal API key limited to some of the current
+// user's permissions. The key itself is only shown in this response.
+func (ac *AuthController) CreateAPIKey(c *gin.Context) {
+	var input dto.APIKeyRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lifetime := maxAPIKeyLifetime
+	if input.ExpiresInDays > 0 {
+		lifetime = time.Duration(input.ExpiresInDays) * 24 * time.Hour
+	}
+	if lifetime > maxAPIKeyLifetime {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API keys can be valid for at most 365 days"})
+		return
+	}
+	expiresAt := time.Now().Add(lifetime)
+
+	userID, _ := c.Get("userID")
+	plaintext, key, err := ac.APIKeys.Create(userID.(uint), input.Name, input.Scopes, &expiresAt)
+	if err != nil {
+		if errors.Is(err, apikeys.ErrScopeNotHeld) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.CreatedAPIKeyResponse{
+		APIKeyResponse: dto.NewAPIKeyResponse(*key),
+		Key:            plaintext,
+	})
+}
+
+// GetAPIKeys lists the current user's API keys without their secrets
+func (ac *AuthController) GetAPIKeys(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	keys, err := ac.APIKeys.List(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewAPIKeyResponses(keys))
+}
+
+// RevokeAPIKey disables one of the current user's API keys
+func (ac *AuthController) RevokeAPIKey(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	keyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	if err := ac.APIKeys.Revoke(userID.(uint), uint(keyID)); err != nil {
+		if errors.Is(err, apikeys.ErrKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"digital-library/backend/internal/dto"
+	"digital-library/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AuditController struct {
+	DB *gorm.DB
+}
+
+// recordAudit stores who performed an administrative action. Failures are
+// logged rather than returned so they never undo the change being audited.
+func recordAudit(db *gorm.DB, c *gin.Context, action, targetType string, targetID uint, details string, args ...interface{}) {
+	actorID, _ := c.Get("userID")
+	id, _ := actorID.(uint)
+
+	entry := models.AuditLog{
+		ActorID:    id,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    fmt.Sprintf(details, args...),
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		log.Printf("Failed to write audit log for %s: %v", action, err)
+	}
+}
+
+// GetAuditLogs lists audit entries, newest first, optionally filtered by actor or target.
+func (ac *AuditController) GetAuditLogs(c *gin.Context) {
+	query := ac.DB.Order("created_at DESC")
+
+	if actorID := c.Query("actor_id"); actorID != "" {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+		return
+	}
+
+	var logs []models.AuditLog
+	if err := query.Limit(limit).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch audit logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewAuditLogResponses(logs))
+}
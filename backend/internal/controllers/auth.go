@@ -3,7 +3,19 @@ package controllers
 import (
 	"net/http"
 	"time"
+	"digital-library/backend/internal/apikeys"
+	"digital-library/backend/internal/authn"
+	"digital-library/backend/internal/dto"
+	"digital-library/backend/internal/emailchange"
+	"digital-library/backend/internal/librarycard"
+	"digital-library/backend/internal/magiclink"
+	"digital-library/backend/internal/mfa"
 	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/onetime"
+	"digital-library/backend/internal/passwords"
+	"digital-library/backend/internal/provisioning"
+	"digital-library/backend/internal/throttle"
+	"digital-library/backend/internal/tokens"
 	"digital-library/backend/internal/utils"
 	"digital-library/backend/pkg/email"
 	"github.com/gin-gonic/gin"
@@ -12,21 +24,52 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"mime/multipart"
 
 
 )
 
+
+// Lifetimes of emailed verification and reset tokens
+const (
+	verifyEmailTTL   = 24 * time.Hour
+	resetPasswordTTL = time.Hour
+)
+
 type AuthController struct {
-	DB    *gorm.DB
-	Email *email.Service
+	DB     *gorm.DB
+	Email  *email.Service
+	Tokens *tokens.Service
+	MFA    *mfa.Service
+	// APIKeys manages the personal API keys users create for scripts
+	APIKeys *apikeys.Service
+	// Passwords validates new passwords against the password policy
+	Passwords *passwords.Policy
+	// Authenticators verify login credentials, e.g. local passwords then LDAP
+	Authenticators authn.Chain
+	// Login attempts are throttled per username and per client IP
+	UserLimiter *throttle.Limiter
+	IPLimiter   *throttle.Limiter
+	// MagicLinks issues passwordless sign-in links, rate limited per address
+	MagicLinks       *magiclink.Service
+	MagicLinkLimiter *throttle.Limiter
+	// OneTimeTokens stores emailed verification and reset tokens
+	OneTimeTokens *onetime.Service
+	// VerificationLimiter enforces a cooldown between verification emails per address
+	VerificationLimiter *throttle.Limiter
+	// EmailChanges holds address changes until the new address is confirmed
+	EmailChanges *emailchange.Service
+	// Cards issues library card numbers to new patrons
+	Cards *librarycard.Service
 }
 
 func (ac *AuthController) Register(c *gin.Context) {
 	var input struct {
 		Username string `json:"username" binding:"required"`
 		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required,min=8"`
+		Password string `json:"password" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -34,6 +77,10 @@ func (ac *AuthController) Register(c *gin.Context) {
 		return
 	}
 
+	if !ac.checkPasswordPolicy(c, models.User{Username: input.Username, Email: input.Email}, input.Password) {
+		return
+	}
+
 	// Check if email already exists
 	var existingUser models.User
 	if err := ac.DB.Where("email = ?", input.Email).First(&existingUser).Error; err == nil {
@@ -41,13 +88,6 @@ func (ac *AuthController) Register(c *gin.Context) {
 		return
 	}
 
-	// Generate verification token
-	token, err := utils.GenerateVerificationToken()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate verification token"})
-		return
-	}
-
 	hashedPassword, err := utils.HashPassword(input.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
@@ -55,12 +95,10 @@ func (ac *AuthController) Register(c *gin.Context) {
 	}
 
 	user := models.User{
-		Username:     input.Username,
-		Email:        input.Email,
-		Password:     hashedPassword,
-		IsVerified:   false,
-		VerifyToken:  token,
-		VerifyExpiry: time.Now().Add(24 * time.Hour),
+		Username:   input.Username,
+		Email:      input.Email,
+		Password:   hashedPassword,
+		IsVerified: false,
 	}
 
 	// Assign default role
@@ -71,8 +109,20 @@ func (ac *AuthController) Register(c *gin.Context) {
 	}
 	user.Roles = append(user.Roles, userRole)
 
-	if err := ac.DB.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+	// Create the user, its library card and its verification token together
+	var token, cardNumber string
+	err = ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if cardNumber, err = ac.Cards.Assign(tx, user.ID); err != nil {
+			return err
+		}
+		token, err = ac.OneTimeTokens.WithTx(tx).Issue(user.ID, onetime.PurposeVerifyEmail, verifyEmailTTL, c.ClientIP())
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create user"})
 		return
 	}
 
@@ -84,7 +134,8 @@ func (ac *AuthController) Register(c *gin.Context) {
 	}()
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "Registration successful. Please check your email to verify your account.",
+		"message":     "Registration successful. Please check your email to verify your account.",
+		"card_number": cardNumber,
 	})
 }
 
@@ -95,16 +146,19 @@ func (ac *AuthController) VerifyEmail(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := ac.DB.Where("verify_token = ? AND verify_expiry > ?", token, time.Now()).First(&user).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
-		return
-	}
-
-	// Mark user as verified
-	user.IsVerified = true
-	user.VerifyToken = ""
-	if err := ac.DB.Save(&user).Error; err != nil {
+	// Consume the token and mark the user verified in one step
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		userID, err := ac.OneTimeTokens.WithTx(tx).Consume(onetime.PurposeVerifyEmail, token)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("is_verified", true).Error
+	})
+	if err != nil {
+		if errors.Is(err, onetime.ErrInvalidToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
 		return
 	}
@@ -123,35 +177,288 @@ func (ac *AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := ac.DB.Where("username = ?", input.Username).Preload("Roles").First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	if !ac.checkLoginThrottle(c, input.Username) {
+		return
+	}
+
+	authenticated, err := ac.Authenticators.Authenticate(input.Username, input.Password)
+	if err != nil {
+		if errors.Is(err, authn.ErrInvalidCredentials) {
+			ac.recordLoginFailure(c, input.Username)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			return
+		}
+		// A directory account whose address a local account already uses
+		if errors.Is(err, provisioning.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Login backend error: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Authentication service unavailable"})
 		return
 	}
+	user := *authenticated
+
+	if err := ac.UserLimiter.Reset(userThrottleKey(input.Username)); err != nil {
+		log.Printf("Failed to reset login throttle: %v", err)
+	}
 
 	if !user.IsVerified {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email first"})
 		return
 	}
 
-	if !utils.CheckPasswordHash(input.Password, user.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	if !user.CanSignIn() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":          "Account is deactivated",
+			"account_status": dto.NewAccountStatus(user),
+		})
+		return
+	}
+
+	// An administrator asked for a new password; the emailed reset link is
+	// the only way back in with a password
+	if user.PasswordResetRequired {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":                   "Password reset required; use the link sent to your email",
+			"password_reset_required": true,
+		})
+		return
+	}
+
+	// With 2FA enabled the password only unlocks the second step
+	if user.TOTPEnabled {
+		challenge, err := ac.MFA.CreateChallenge(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start two-factor login"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required":    true,
+			"challenge_token": challenge,
+		})
+		return
+	}
+
+	pair, err := ac.Tokens.Issue(user, tokens.Client{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	})
+	if err != nil {
+		respondIssueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pair)
+}
+
+// respondIssueError writes the response for a session that could not be started
+func respondIssueError(c *gin.Context, err error) {
+	if errors.Is(err, tokens.ErrAccountDeactivated) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+}
+
+func userThrottleKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+// checkLoginThrottle rejects the attempt if the username is locked or either
+// the username or the client IP is still backing off after failures
+func (ac *AuthController) checkLoginThrottle(c *gin.Context, username string) bool {
+	userStatus, err := ac.UserLimiter.Check(userThrottleKey(username))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check login attempts"})
+		return false
+	}
+	ipStatus, err := ac.IPLimiter.Check("ip:" + c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check login attempts"})
+		return false
+	}
+
+	if userStatus.Locked {
+		c.Header("Retry-After", strconv.Itoa(int(userStatus.RetryAfter.Seconds())+1))
+		c.JSON(http.StatusLocked, gin.H{"error": "Account temporarily locked due to too many failed login attempts"})
+		return false
+	}
+
+	retryAfter := userStatus.RetryAfter
+	if ipStatus.RetryAfter > retryAfter {
+		retryAfter = ipStatus.RetryAfter
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, please try again later"})
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure counts a failed attempt against the username and IP and
+// notifies the account owner when the account becomes locked
+func (ac *AuthController) recordLoginFailure(c *gin.Context, username string) {
+	if _, _, err := ac.IPLimiter.Fail("ip:" + c.ClientIP()); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+
+	record, locked, err := ac.UserLimiter.Fail(userThrottleKey(username))
+	if err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+		return
+	}
+
+	if !locked {
+		return
+	}
+
+	var user models.User
+	if err := ac.DB.Where("username = ?", username).First(&user).Error; err == nil {
+		log.Printf("Account %q locked after %d failed login attempts", user.Username, record.Failures)
+		email := user.Email
+		go func() {
+			if err := ac.Email.SendAccountLockedEmail(email, record.LockedUntil); err != nil {
+				log.Printf("Failed to send account locked email: %v", err)
+			}
+		}()
+	}
+}
+
+// UnlockUser lets an administrator clear a user's login lockout
+func (ac *AuthController) UnlockUser(c *gin.Context) {
+	var user models.User
+	if err := ac.DB.First(&user, c.Param("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := ac.UserLimiter.Reset(userThrottleKey(user.Username)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not unlock user"})
+		return
+	}
+
+	recordAudit(ac.DB, c, "user.unlock", "user", user.ID, "cleared login lockout of user %q", user.Username)
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
+
+// Refresh exchanges a refresh token for a new access/refresh token pair
+func (ac *AuthController) Refresh(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pair, err := ac.Tokens.Rotate(input.RefreshToken)
+	if err != nil {
+		if errors.Is(err, tokens.ErrTokenReuse) {
+			log.Printf("Refresh token reuse detected; token family revoked")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used; please log in again"})
+			return
+		}
+		if errors.Is(err, tokens.ErrInvalidToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
+		if errors.Is(err, tokens.ErrAccountDeactivated) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pair)
+}
+
+// Logout revokes the session the refresh token belongs to
+func (ac *AuthController) Logout(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get role names
-	var roleNames []string
-	for _, role := range user.Roles {
-		roleNames = append(roleNames, role.Name)
+	if err := ac.Tokens.Revoke(input.RefreshToken); err != nil && !errors.Is(err, tokens.ErrInvalidToken) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// GetSessions lists the devices the current user is logged in on
+func (ac *AuthController) GetSessions(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	sessionID, _ := c.Get("sessionID")
+	currentSessionID, _ := sessionID.(uint)
+
+	sessions, err := ac.Tokens.Sessions(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch sessions"})
+		return
 	}
 
-	token, err := utils.GenerateJWT(user.ID, roleNames)
+	c.JSON(http.StatusOK, dto.NewSessionResponses(sessions, currentSessionID))
+}
+
+// RevokeSession logs the current user out of one of their sessions
+func (ac *AuthController) RevokeSession(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := ac.Tokens.RevokeSession(userID.(uint), uint(sessionID)); err != nil {
+		if errors.Is(err, tokens.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// LogoutAll revokes every session of the current user
+func (ac *AuthController) LogoutAll(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := ac.Tokens.RevokeAll(userID.(uint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions logged out"})
+}
+
+// LogoutUser lets an administrator revoke every session of another user
+func (ac *AuthController) LogoutUser(c *gin.Context) {
+	var user models.User
+	if err := ac.DB.First(&user, c.Param("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := ac.Tokens.RevokeAll(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not log out user"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	recordAudit(ac.DB, c, "user.logout_all", "user", user.ID, "revoked all sessions of user %q", user.Username)
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions of the user logged out"})
 }
 
 // ForgotPassword handles password reset requests
@@ -178,16 +485,8 @@ func (ac *AuthController) ForgotPassword(c *gin.Context) {
 	}
 
 	// Generate reset token
-	token, err := utils.GenerateVerificationToken()
+	token, err := ac.OneTimeTokens.Issue(user.ID, onetime.PurposeResetPassword, resetPasswordTTL, c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
-		return
-	}
-
-	// Set reset token and expiry (1 hour)
-	user.ResetToken = token
-	user.ResetExpiry = time.Now().Add(1 * time.Hour)
-	if err := ac.DB.Save(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save reset token"})
 		return
 	}
@@ -195,18 +494,18 @@ func (ac *AuthController) ForgotPassword(c *gin.Context) {
 	// Send reset email
 	go func() {
 		if err := ac.Email.SendResetPasswordEmail(user.Email, token); err != nil {
-			log.Printf("Failed to send verification email: %v", err)
+			log.Printf("Failed to send reset password email: %v", err)
 		}
 	}()
 
-		
+	c.JSON(http.StatusOK, gin.H{"message": "If this email exists, a reset link has been sent"})
 }
 
 // ResetPassword handles password reset
 func (ac *AuthController) ResetPassword(c *gin.Context) {
 	var input struct {
 		Token       string `json:"token" binding:"required"`
-		NewPassword string `json:"new_password" binding:"required,min=8"`
+		NewPassword string `json:"new_password" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -214,13 +513,26 @@ func (ac *AuthController) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	// Find user by valid reset token
+	// Find user by valid reset token; it is only spent once the new password is accepted
+	userID, err := ac.OneTimeTokens.Peek(onetime.PurposeResetPassword, input.Token)
+	if err != nil {
+		if errors.Is(err, onetime.ErrInvalidToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
 	var user models.User
-	if err := ac.DB.Where("reset_token = ? AND reset_expiry > ?", input.Token, time.Now()).First(&user).Error; err != nil {
+	if err := ac.DB.First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
 		return
 	}
 
+	if !ac.checkPasswordPolicy(c, user, input.NewPassword) {
+		return
+	}
+
 	// Hash new password
 	hashedPassword, err := utils.HashPassword(input.NewPassword)
 	if err != nil {
@@ -228,17 +540,61 @@ func (ac *AuthController) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	// Update password and clear reset token
-	user.Password = hashedPassword
-	user.ResetToken = ""
-	if err := ac.DB.Save(&user).Error; err != nil {
+	// Spend the reset token and update the password, remembering the old one
+	oldHash := user.Password
+	err = ac.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := ac.OneTimeTokens.WithTx(tx).Consume(onetime.PurposeResetPassword, input.Token); err != nil {
+			return err
+		}
+		if err := ac.Passwords.Remember(tx, user.ID, oldHash); err != nil {
+			return err
+		}
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"password":                hashedPassword,
+			"password_reset_required": false,
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, onetime.ErrInvalidToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
 
+	// Whoever knew the old password must not stay logged in
+	if err := ac.Tokens.RevokeAll(user.ID); err != nil {
+		log.Printf("Failed to revoke sessions after password reset: %v", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
 }
 
+// checkPasswordPolicy responds with the policy violations and returns false
+// if the password may not be used for the account
+func (ac *AuthController) checkPasswordPolicy(c *gin.Context, user models.User, password string) bool {
+	violations, err := ac.Passwords.Check(user, password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check password"})
+		return false
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      "Password does not meet the password policy",
+			"violations": violations,
+		})
+		return false
+	}
+	return true
+}
+
+// JWKS publishes the public keys other services use to verify library tokens
+func (ac *AuthController) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": utils.PublicJWKS()})
+}
+
 // Add to AuthController struct
 const uploadDir = "./uploads/profile_photos"
 
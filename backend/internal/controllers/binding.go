@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"net/http"
+
+	"digital-library/backend/internal/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// bindUpdate fills target, a request DTO, for an update of the record that
+// current describes. A PATCH body is applied to current as a JSON merge
+// patch; a PUT body replaces it. Fields the DTO does not declare are
+// rejected either way. It responds and returns false if the body is invalid.
+func bindUpdate(c *gin.Context, current, target interface{}) bool {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read request body"})
+		return false
+	}
+
+	if c.Request.Method == http.MethodPatch {
+		err = dto.ApplyMergePatch(current, body, target)
+	} else {
+		err = dto.DecodeStrict(body, target)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
@@ -1,40 +1,259 @@
 package controllers
 import (
 	"net/http"
+	"strconv"
+	"strings"
+	"digital-library/backend/internal/dto"
+	"digital-library/backend/internal/holdings"
 	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/search"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
 )
 
 type BookController struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Search search.Engine
 }
 func (bc *BookController) CreateBook(c *gin.Context) {
-	var book models.Book
-	if err := c.ShouldBindJSON(&book); err != nil {
+	var input dto.BookRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// New books have no copies until they are added
+	book := models.Book{Status: models.BookUnavailable}
+	input.Apply(&book)
 	if err := bc.DB.Create(&book).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not create book"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, book)
+	bc.DB.Preload("Category").First(&book, book.ID)
+	responses, err := bc.bookResponses(book)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not count copies"})
+		return
+	}
+	c.JSON(http.StatusCreated, responses[0])
+}
+
+// bookResponses converts books to responses, with their copies counted
+func (bc *BookController) bookResponses(books ...models.Book) ([]dto.BookResponse, error) {
+	responses := dto.NewBookResponses(books)
+	refs := make([]*dto.BookResponse, len(responses))
+	for i := range responses {
+		refs[i] = &responses[i]
+	}
+	return responses, bc.countCopies(refs...)
+}
+
+// countCopies fills in the availability of the responses' books
+func (bc *BookController) countCopies(responses ...*dto.BookResponse) error {
+	ids := make([]uint, 0, len(responses))
+	for _, response := range responses {
+		ids = append(ids, response.ID)
+	}
+	availability, err := holdings.Load(bc.DB, ids)
+	if err != nil {
+		return err
+	}
+	for _, response := range responses {
+		counts := availability[response.ID]
+		response.Availability = &counts
+	}
+	return nil
+}
+
+// bookSortFields are the fields GET /books may be sorted by
+var bookSortFields = map[string]sortField[models.Book]{
+	"id":               {Column: "id", Value: func(b models.Book) interface{} { return b.ID }},
+	"title":            {Column: "title", Value: func(b models.Book) interface{} { return b.Title }},
+	"author":           {Column: "author", Value: func(b models.Book) interface{} { return b.Author }},
+	"publication_year": {Column: "publication_year", Value: func(b models.Book) interface{} { return b.PublicationYear }},
+	"language":         {Column: "language", Value: func(b models.Book) interface{} { return b.Language }},
+	"status":           {Column: "status", Value: func(b models.Book) interface{} { return b.Status }},
+	"created_at":       {Column: "created_at", Value: func(b models.Book) interface{} { return b.CreatedAt }},
 }
 
+// GetBooks lists books a page at a time. Pages are numbered (?page=) unless
+// ?cursor= is given, which pages by position instead and stays consistent
+// while books are added; an empty cursor starts at the beginning. Either
+// way the Link header points at further pages and X-Total-Count counts
+// every matching book.
 func (bc *BookController) GetBooks(c *gin.Context) {
+	pageSize, ok := parsePageSize(c)
+	if !ok {
+		return
+	}
+	order, ok := parseSort(c, bookSortFields, "title")
+	if !ok {
+		return
+	}
+	query, ok := bc.filterBooks(c)
+	if !ok {
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch books"})
+		return
+	}
+	query = order.apply(query.Preload("Category"))
+
+	position, byCursor := c.GetQuery("cursor")
+	if !byCursor {
+		page, ok := parsePagination(c)
+		if !ok {
+			return
+		}
+
+		var books []models.Book
+		if err := page.apply(query).Find(&books).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch books"})
+			return
+		}
+		responses, err := bc.bookResponses(books...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch books"})
+			return
+		}
+		page.setHeaders(c, total)
+		c.JSON(http.StatusOK, responses)
+		return
+	}
+
+	if position != "" {
+		var err error
+		if query, err = order.after(query, position); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+	}
+
+	// One extra row tells whether there is a next page
 	var books []models.Book
-	if err := bc.DB.Preload("Category").Find(&books).Error; err != nil {
+	if err := query.Limit(pageSize + 1).Find(&books).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch books"})
 		return
 	}
 
-	c.JSON(http.StatusOK, books)
+	setTotalCount(c, total)
+	links := []string{listLink(c, "first", map[string]string{"cursor": ""})}
+	if len(books) > pageSize {
+		books = books[:pageSize]
+		links = append(links, listLink(c, "next", map[string]string{"cursor": order.encodeCursor(books[pageSize-1])}))
+	}
+	responses, err := bc.bookResponses(books...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch books"})
+		return
+	}
+	c.Header("Link", strings.Join(links, ", "))
+	c.JSON(http.StatusOK, responses)
 }
 
+// filterBooks builds the query for the books matching the list filters:
+// author (partial match), category (ID or name, including its
+// subcategories), status and language (each a comma-separated list), and
+// year, year_from and year_to for the publication year.
+func (bc *BookController) filterBooks(c *gin.Context) (*gorm.DB, bool) {
+	query := bc.DB.Model(&models.Book{})
+
+	if author := strings.TrimSpace(c.Query("author")); author != "" {
+		query = query.Where("author ILIKE ?", likePattern(author))
+	}
+	if category := strings.TrimSpace(c.Query("category")); category != "" {
+		root := "LOWER(name) = LOWER(@category)"
+		var value interface{} = category
+		if id, err := strconv.ParseUint(category, 10, 64); err == nil {
+			root, value = "id = @category", id
+		}
+		query = query.Where(`category_id IN (
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM categories WHERE `+root+` AND deleted_at IS NULL
+				UNION
+				SELECT categories.id FROM categories JOIN subtree ON categories.parent_id = subtree.id
+				WHERE categories.deleted_at IS NULL
+			)
+			SELECT id FROM subtree)`, map[string]interface{}{"category": value})
+	}
+	if statuses := splitQuery(c, "status"); len(statuses) > 0 {
+		for i := range statuses {
+			statuses[i] = strings.ToUpper(statuses[i])
+		}
+		query = query.Where("status IN ?", statuses)
+	}
+	if languages := splitQuery(c, "language"); len(languages) > 0 {
+		for i := range languages {
+			languages[i] = strings.ToLower(languages[i])
+		}
+		query = query.Where("language IN ?", languages)
+	}
+
+	for param, condition := range map[string]string{
+		"year":      "publication_year = ?",
+		"year_from": "publication_year >= ?",
+		"year_to":   "publication_year <= ?",
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		year, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a year"})
+			return nil, false
+		}
+		query = query.Where(condition, year)
+	}
+
+	return query, true
+}
+
+// SearchBooks finds books matching ?q=, best matches first. The query may
+// contain "quoted phrases", -excluded words and prefix* words; category,
+// author and status narrow the results to one facet value.
+func (bc *BookController) SearchBooks(c *gin.Context) {
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	page, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	results, err := bc.Search.Search(search.Query{
+		Text:     text,
+		Category: c.Query("category"),
+		Author:   c.Query("author"),
+		Status:   c.Query("status"),
+		Limit:    page.PageSize,
+		Offset:   (page.Page - 1) * page.PageSize,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not search books"})
+		return
+	}
+
+	response := dto.NewBookSearchResponse(results)
+	refs := make([]*dto.BookResponse, len(response.Hits))
+	for i := range response.Hits {
+		refs[i] = &response.Hits[i].BookResponse
+	}
+	if err := bc.countCopies(refs...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not search books"})
+		return
+	}
+
+	page.setHeaders(c, results.Total)
+	c.JSON(http.StatusOK, response)
+}
 
 func (bc *BookController) GetBook(c *gin.Context) {
 	var book models.Book
@@ -43,9 +262,16 @@ func (bc *BookController) GetBook(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
 		return
 	}
-	c.JSON(http.StatusOK, book)
+	responses, err := bc.bookResponses(book)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not count copies"})
+		return
+	}
+	c.JSON(http.StatusOK, responses[0])
 }
 
+// UpdateBook replaces a book's editable fields (PUT) or changes some of them
+// with a JSON merge patch (PATCH)
 func (bc *BookController) UpdateBook(c *gin.Context) {
 	var book models.Book
 	bookID := c.Param("id")
@@ -53,15 +279,25 @@ func (bc *BookController) UpdateBook(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
 		return
 	}
-	if err := c.ShouldBindJSON(&book); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+	var input dto.BookRequest
+	if !bindUpdate(c, dto.NewBookRequest(book), &input) {
 		return
 	}
-	if err := bc.DB.Save(&book).Error; err != nil {
+
+	input.Apply(&book)
+	if err := bc.DB.Model(&book).Select(dto.BookColumns).Updates(&book).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update book"})
 		return
 	}
-	c.JSON(http.StatusOK, book)
+
+	bc.DB.Preload("Category").First(&book, book.ID)
+	responses, err := bc.bookResponses(book)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not count copies"})
+		return
+	}
+	c.JSON(http.StatusOK, responses[0])
 }
 func (bc *BookController) DeleteBook(c *gin.Context) {
 	var book models.Book
@@ -70,7 +306,24 @@ func (bc *BookController) DeleteBook(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
 		return
 	}
-	if err := bc.DB.Delete(&book).Error; err != nil {
+
+	// A book goes with its copies, which must all be back on the shelf
+	var onLoan int64
+	if err := bc.DB.Model(&models.Copy{}).Where("book_id = ? AND status = ?", book.ID, models.CopyCheckedOut).Count(&onLoan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete book"})
+		return
+	}
+	if onLoan > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Book has copies on loan", "copies_on_loan": onLoan})
+		return
+	}
+	err := bc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("book_id = ?", book.ID).Delete(&models.Copy{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&book).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete book"})
 		return
 	}
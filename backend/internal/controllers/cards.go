@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"digital-library/backend/internal/dto"
+	"digital-library/backend/internal/librarycard"
+	"digital-library/backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Barcode image size limits, in pixels
+const (
+	defaultBarcodeWidth  = 400
+	defaultBarcodeHeight = 100
+	maxBarcodeSize       = 2000
+)
+
+// writeCardBarcode responds with the user's card number as a barcode image.
+// ?format= picks png (default) or svg; ?width= and ?height= size it.
+func writeCardBarcode(c *gin.Context, user models.User) {
+	if user.CardNumber == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No library card has been issued"})
+		return
+	}
+
+	format := c.DefaultQuery("format", librarycard.FormatPNG)
+	width, err := strconv.Atoi(c.DefaultQuery("width", strconv.Itoa(defaultBarcodeWidth)))
+	if err != nil || width < 1 || width > maxBarcodeSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "width must be between 1 and " + strconv.Itoa(maxBarcodeSize)})
+		return
+	}
+	height, err := strconv.Atoi(c.DefaultQuery("height", strconv.Itoa(defaultBarcodeHeight)))
+	if err != nil || height < 1 || height > maxBarcodeSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "height must be between 1 and " + strconv.Itoa(maxBarcodeSize)})
+		return
+	}
+
+	var image bytes.Buffer
+	if err := librarycard.RenderBarcode(&image, *user.CardNumber, format, width, height); err != nil {
+		if errors.Is(err, librarycard.ErrUnsupportedFormat) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be png or svg"})
+			return
+		}
+		// Too narrow to fit every bar
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not render barcode: " + err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, librarycard.ContentType(format), image.Bytes())
+}
+
+// LookupCard finds the patron a scanned library card belongs to, so desk
+// staff can start a checkout without searching by name
+func (uc *UserController) LookupCard(c *gin.Context) {
+	user, err := uc.Cards.Lookup(c.Param("number"))
+	if err != nil {
+		switch {
+		case errors.Is(err, librarycard.ErrInvalidNumber):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Not a valid library card number"})
+		case errors.Is(err, librarycard.ErrCardNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Library card not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not look up library card"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":           dto.NewUserResponse(*user),
+		"account_status": dto.NewAccountStatus(*user),
+		"can_borrow":     user.CanBorrow(),
+	})
+}
+
+// GetUserCardBarcode renders a user's library card for printing
+func (uc *UserController) GetUserCardBarcode(c *gin.Context) {
+	user, ok := uc.findUser(c)
+	if !ok {
+		return
+	}
+	writeCardBarcode(c, user)
+}
+
+// ReissueCard replaces a lost or stolen library card with a new number; the
+// old number stops working
+func (uc *UserController) ReissueCard(c *gin.Context) {
+	user, ok := uc.findUser(c)
+	if !ok {
+		return
+	}
+
+	number, err := uc.Cards.Assign(uc.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not issue library card"})
+		return
+	}
+	user.CardNumber = &number
+
+	recordAudit(uc.DB, c, "user.reissue_card", "user", user.ID, "issued a new library card to user %q", user.Username)
+	c.JSON(http.StatusOK, dto.NewUserResponse(user))
+}
+
+// GetMyCardBarcode renders the signed-in user's library card, e.g. for a
+// phone screen at the desk
+func (pc *ProfileController) GetMyCardBarcode(c *gin.Context) {
+	user, ok := pc.loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	writeCardBarcode(c, *user)
+}
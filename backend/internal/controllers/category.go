@@ -0,0 +1,377 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"digital-library/backend/internal/dto"
+	"digital-library/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// Postgres error codes for constraint violations
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+var (
+	errCategoryNotFound = errors.New("category not found")
+	errParentNotFound   = errors.New("parent category not found")
+	errTargetNotFound   = errors.New("target category not found")
+	errCategoryCycle    = errors.New("a category cannot be placed inside its own subtree")
+	errMergeIntoSelf    = errors.New("a category cannot be merged into itself")
+)
+
+type CategoryController struct {
+	DB *gorm.DB
+}
+
+// categoryTree is every category with the number of books filed directly
+// under each.
+type categoryTree struct {
+	categories map[uint]models.Category
+	// children lists each category's subcategories by name; key 0 holds
+	// the top of the tree
+	children map[uint][]uint
+	books    map[uint]int64
+}
+
+func loadCategoryTree(db *gorm.DB) (*categoryTree, error) {
+	var categories []models.Category
+	if err := db.Order("name").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	tree := &categoryTree{
+		categories: make(map[uint]models.Category, len(categories)),
+		children:   map[uint][]uint{},
+		books:      map[uint]int64{},
+	}
+	for _, category := range categories {
+		tree.categories[category.ID] = category
+		var parent uint
+		if category.ParentID != nil {
+			parent = *category.ParentID
+		}
+		tree.children[parent] = append(tree.children[parent], category.ID)
+	}
+
+	var counts []struct {
+		CategoryID uint
+		Count      int64
+	}
+	err := db.Model(&models.Book{}).
+		Select("category_id, COUNT(*) AS count").
+		Group("category_id").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		tree.books[count.CategoryID] = count.Count
+	}
+	return tree, nil
+}
+
+func (t *categoryTree) has(id uint) bool {
+	_, ok := t.categories[id]
+	return ok
+}
+
+// node returns the category with its subtree and book counts.
+func (t *categoryTree) node(id uint) dto.CategoryNodeResponse {
+	category := t.categories[id]
+	node := dto.CategoryNodeResponse{
+		ID:        category.ID,
+		Name:      category.Name,
+		ParentID:  category.ParentID,
+		BookCount: t.books[id],
+		Children:  make([]dto.CategoryNodeResponse, 0, len(t.children[id])),
+	}
+	node.TotalBookCount = node.BookCount
+	for _, childID := range t.children[id] {
+		child := t.node(childID)
+		node.TotalBookCount += child.TotalBookCount
+		node.Children = append(node.Children, child)
+	}
+	return node
+}
+
+// path returns the categories above the given one, from the top down.
+func (t *categoryTree) path(id uint) []dto.CategoryResponse {
+	path := []dto.CategoryResponse{}
+	for parent := t.categories[id].ParentID; parent != nil; parent = t.categories[*parent].ParentID {
+		path = append([]dto.CategoryResponse{dto.NewCategoryResponse(t.categories[*parent])}, path...)
+	}
+	return path
+}
+
+// within reports whether the category is the ancestor or lies in its subtree.
+func (t *categoryTree) within(id, ancestor uint) bool {
+	for current := &id; current != nil; current = t.categories[*current].ParentID {
+		if *current == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// lockCategories loads the tree inside tx after locking the categories
+// table against other writers, so that concurrent moves cannot combine
+// into a cycle.
+func lockCategories(tx *gorm.DB) (*categoryTree, error) {
+	if err := tx.Exec("LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+		return nil, err
+	}
+	return loadCategoryTree(tx)
+}
+
+// GetCategories lists the category tree with book counts per category
+func (cc *CategoryController) GetCategories(c *gin.Context) {
+	tree, err := loadCategoryTree(cc.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch categories"})
+		return
+	}
+
+	roots := make([]dto.CategoryNodeResponse, 0, len(tree.children[0]))
+	for _, id := range tree.children[0] {
+		roots = append(roots, tree.node(id))
+	}
+	c.JSON(http.StatusOK, roots)
+}
+
+// GetCategory returns a category's subtree and the path leading to it
+func (cc *CategoryController) GetCategory(c *gin.Context) {
+	var category models.Category
+	if err := cc.DB.First(&category, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+	cc.respondCategory(c, http.StatusOK, category.ID)
+}
+
+func (cc *CategoryController) CreateCategory(c *gin.Context) {
+	var input dto.CategoryRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category := models.Category{Name: strings.TrimSpace(input.Name), ParentID: input.ParentID}
+	if input.ParentID != nil {
+		var parent models.Category
+		if err := cc.DB.First(&parent, *input.ParentID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent category not found"})
+			return
+		}
+	}
+	if err := cc.DB.Create(&category).Error; err != nil {
+		respondCategoryWriteError(c, err, "Could not create category")
+		return
+	}
+
+	recordAudit(cc.DB, c, "category.create", "category", category.ID, "created category %q", category.Name)
+	cc.respondCategory(c, http.StatusCreated, category.ID)
+}
+
+// RenameCategory changes a category's name; its books and subcategories stay
+func (cc *CategoryController) RenameCategory(c *gin.Context) {
+	var input dto.CategoryRenameRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var category models.Category
+	if err := cc.DB.First(&category, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	oldName := category.Name
+	if err := cc.DB.Model(&category).Update("name", strings.TrimSpace(input.Name)).Error; err != nil {
+		respondCategoryWriteError(c, err, "Could not rename category")
+		return
+	}
+
+	recordAudit(cc.DB, c, "category.rename", "category", category.ID, "renamed category %q to %q", oldName, category.Name)
+	cc.respondCategory(c, http.StatusOK, category.ID)
+}
+
+// MoveCategory places a category, with its subtree, under another parent
+// or at the top of the tree
+func (cc *CategoryController) MoveCategory(c *gin.Context) {
+	var input dto.CategoryMoveRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var category models.Category
+	if err := cc.DB.First(&category, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	destination := "the top level"
+	err := cc.DB.Transaction(func(tx *gorm.DB) error {
+		tree, err := lockCategories(tx)
+		if err != nil {
+			return err
+		}
+		if !tree.has(category.ID) {
+			return errCategoryNotFound
+		}
+		if input.ParentID != nil {
+			if !tree.has(*input.ParentID) {
+				return errParentNotFound
+			}
+			if tree.within(*input.ParentID, category.ID) {
+				return errCategoryCycle
+			}
+			destination = "\"" + tree.categories[*input.ParentID].Name + "\""
+		}
+		return tx.Model(&category).Update("parent_id", input.ParentID).Error
+	})
+	if err != nil {
+		respondCategoryError(c, err, "Could not move category")
+		return
+	}
+
+	recordAudit(cc.DB, c, "category.move", "category", category.ID, "moved category %q to %s", category.Name, destination)
+	cc.respondCategory(c, http.StatusOK, category.ID)
+}
+
+// MergeCategory moves a category's books and subcategories into the target
+// category and deletes it
+func (cc *CategoryController) MergeCategory(c *gin.Context) {
+	var input dto.CategoryMergeRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var source models.Category
+	if err := cc.DB.First(&source, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	var target models.Category
+	var moved int64
+	err := cc.DB.Transaction(func(tx *gorm.DB) error {
+		tree, err := lockCategories(tx)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !tree.has(source.ID):
+			return errCategoryNotFound
+		case !tree.has(input.TargetID):
+			return errTargetNotFound
+		case input.TargetID == source.ID:
+			return errMergeIntoSelf
+		case tree.within(input.TargetID, source.ID):
+			return errCategoryCycle
+		}
+		target = tree.categories[input.TargetID]
+
+		// Deleted books and categories are moved too: they still reference it
+		result := tx.Unscoped().Model(&models.Book{}).Where("category_id = ?", source.ID).Update("category_id", target.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		moved = result.RowsAffected
+		if err := tx.Unscoped().Model(&models.Category{}).Where("parent_id = ?", source.ID).Update("parent_id", target.ID).Error; err != nil {
+			return err
+		}
+		// Hard delete so the name can be reused
+		return tx.Unscoped().Delete(&source).Error
+	})
+	if err != nil {
+		respondCategoryError(c, err, "Could not merge category")
+		return
+	}
+
+	recordAudit(cc.DB, c, "category.merge", "category", target.ID, "merged category %q into %q, moving %d books", source.Name, target.Name, moved)
+	cc.respondCategory(c, http.StatusOK, target.ID)
+}
+
+// DeleteCategory deletes a category no book or subcategory refers to
+func (cc *CategoryController) DeleteCategory(c *gin.Context) {
+	var category models.Category
+	if err := cc.DB.First(&category, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	// Deleted books count as well: their loan history still shows the category
+	var books, subcategories int64
+	if err := cc.DB.Unscoped().Model(&models.Book{}).Where("category_id = ?", category.ID).Count(&books).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete category"})
+		return
+	}
+	if err := cc.DB.Unscoped().Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&subcategories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete category"})
+		return
+	}
+	if books > 0 || subcategories > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":             "Category is still in use; move its books and subcategories or merge it into another category",
+			"book_count":        books,
+			"subcategory_count": subcategories,
+		})
+		return
+	}
+
+	// Hard delete so the name can be reused
+	if err := cc.DB.Unscoped().Delete(&category).Error; err != nil {
+		respondCategoryWriteError(c, err, "Could not delete category")
+		return
+	}
+
+	recordAudit(cc.DB, c, "category.delete", "category", category.ID, "deleted category %q", category.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+func (cc *CategoryController) respondCategory(c *gin.Context, status int, id uint) {
+	tree, err := loadCategoryTree(cc.DB)
+	if err != nil || !tree.has(id) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch category"})
+		return
+	}
+	c.JSON(status, dto.CategoryDetailResponse{CategoryNodeResponse: tree.node(id), Path: tree.path(id)})
+}
+
+// respondCategoryError maps a failed tree change to a response.
+func respondCategoryError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, errCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+	case errors.Is(err, errParentNotFound), errors.Is(err, errTargetNotFound), errors.Is(err, errMergeIntoSelf):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errCategoryCycle):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		respondCategoryWriteError(c, err, message)
+	}
+}
+
+// respondCategoryWriteError reports a taken name or a category still in
+// use as a conflict.
+func respondCategoryWriteError(c *gin.Context, err error, message string) {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+		c.JSON(http.StatusConflict, gin.H{"error": "A category with this name already exists"})
+	case errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation:
+		c.JSON(http.StatusConflict, gin.H{"error": "Category is still in use"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"digital-library/backend/internal/dto"
+	"digital-library/backend/internal/holdings"
+	"digital-library/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// errCopyOnLoan is returned when a copy was checked out after it was read.
+var errCopyOnLoan = errors.New("copy is on loan")
+
+type CopyController struct {
+	DB *gorm.DB
+}
+
+// GetBookCopies lists the copies of a book
+func (cc *CopyController) GetBookCopies(c *gin.Context) {
+	var book models.Book
+	if err := cc.DB.First(&book, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		return
+	}
+
+	var copies []models.Copy
+	if err := cc.DB.Where("book_id = ?", book.ID).Order("barcode").Find(&copies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch copies"})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewCopyResponses(copies))
+}
+
+// AddCopy registers a new physical copy of a book
+func (cc *CopyController) AddCopy(c *gin.Context) {
+	var input dto.CopyRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var book models.Book
+	if err := cc.DB.First(&book, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		return
+	}
+
+	item := models.Copy{BookID: book.ID}
+	input.Apply(&item)
+	err := cc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		return holdings.Refresh(tx, book.ID)
+	})
+	if err != nil {
+		respondCopyWriteError(c, err, "Could not add copy")
+		return
+	}
+
+	recordAudit(cc.DB, c, "copy.create", "copy", item.ID, "added copy %s of book %q", item.Barcode, book.Title)
+	item.Book = book
+	c.JSON(http.StatusCreated, dto.NewCopyResponse(item))
+}
+
+func (cc *CopyController) GetCopy(c *gin.Context) {
+	var item models.Copy
+	if err := cc.DB.Preload("Book").First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Copy not found"})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewCopyResponse(item))
+}
+
+// GetCopyByBarcode finds a copy by its scanned barcode
+func (cc *CopyController) GetCopyByBarcode(c *gin.Context) {
+	var item models.Copy
+	if err := cc.DB.Preload("Book").Where("barcode = ?", c.Param("barcode")).First(&item).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Copy not found"})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewCopyResponse(item))
+}
+
+// UpdateCopy replaces a copy's editable fields (PUT) or changes some of them
+// with a JSON merge patch (PATCH). The status of a copy on loan cannot be
+// changed; returning it puts it back on the shelf.
+func (cc *CopyController) UpdateCopy(c *gin.Context) {
+	var item models.Copy
+	if err := cc.DB.Preload("Book").First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Copy not found"})
+		return
+	}
+
+	var input dto.CopyRequest
+	if !bindUpdate(c, dto.NewCopyRequest(item), &input) {
+		return
+	}
+	if item.Status == models.CopyCheckedOut && input.Status != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Copy is on loan; return it before changing its status"})
+		return
+	}
+
+	input.Apply(&item)
+	err := cc.DB.Transaction(func(tx *gorm.DB) error {
+		// The copy may have been checked out since it was read
+		query := tx.Model(&item)
+		if input.Status != "" {
+			query = query.Where("status <> ?", models.CopyCheckedOut)
+		}
+		result := query.Select(input.Columns()).Updates(&item)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errCopyOnLoan
+		}
+		return holdings.Refresh(tx, item.BookID)
+	})
+	if errors.Is(err, errCopyOnLoan) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Copy is on loan; return it before changing its status"})
+		return
+	}
+	if err != nil {
+		respondCopyWriteError(c, err, "Could not update copy")
+		return
+	}
+
+	recordAudit(cc.DB, c, "copy.update", "copy", item.ID, "updated copy %s: %s, %s, shelf %q", item.Barcode, item.Status, item.Condition, item.ShelfLocation)
+	c.JSON(http.StatusOK, dto.NewCopyResponse(item))
+}
+
+// DeleteCopy removes a copy that is not on loan. Loans of it keep
+// referring to it.
+func (cc *CopyController) DeleteCopy(c *gin.Context) {
+	var item models.Copy
+	if err := cc.DB.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Copy not found"})
+		return
+	}
+	if item.Status == models.CopyCheckedOut {
+		c.JSON(http.StatusConflict, gin.H{"error": "Copy is on loan; return it before deleting it"})
+		return
+	}
+
+	err := cc.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("status <> ?", models.CopyCheckedOut).Delete(&item)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errCopyOnLoan
+		}
+		return holdings.Refresh(tx, item.BookID)
+	})
+	if errors.Is(err, errCopyOnLoan) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Copy is on loan; return it before deleting it"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete copy"})
+		return
+	}
+
+	recordAudit(cc.DB, c, "copy.delete", "copy", item.ID, "deleted copy %s", item.Barcode)
+	c.JSON(http.StatusOK, gin.H{"message": "Copy deleted successfully"})
+}
+
+// respondCopyWriteError reports a barcode already in use as a conflict.
+func respondCopyWriteError(c *gin.Context, err error, message string) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		c.JSON(http.StatusConflict, gin.H{"error": "A copy with this barcode already exists"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
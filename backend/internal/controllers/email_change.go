@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"digital-library/backend/internal/emailchange"
+	"digital-library/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestEmailChange starts changing the current user's email. The new
+// address only takes effect once confirmed from that address.
+func (ac *AuthController) RequestEmailChange(c *gin.Context) {
+	var input struct {
+		NewEmail string `json:"new_email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !utils.CheckPasswordHash(input.Password, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	token, err := ac.EmailChanges.Request(*user, input.NewEmail)
+	if err != nil {
+		switch {
+		case errors.Is(err, emailchange.ErrEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		case errors.Is(err, emailchange.ErrSameEmail):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not request email change"})
+		}
+		return
+	}
+
+	oldEmail := user.Email
+	go func() {
+		if err := ac.Email.SendEmailChangeConfirmation(input.NewEmail, token); err != nil {
+			log.Printf("Failed to send email change confirmation: %v", err)
+		}
+		if err := ac.Email.SendEmailChangeNotice(oldEmail, input.NewEmail); err != nil {
+			log.Printf("Failed to send email change notice: %v", err)
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Check your new email address to confirm the change"})
+}
+
+// ConfirmEmailChange applies a pending email change from its confirmation link
+func (ac *AuthController) ConfirmEmailChange(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Confirmation token is required"})
+		return
+	}
+
+	user, oldEmail, err := ac.EmailChanges.Confirm(token)
+	if err != nil {
+		switch {
+		case errors.Is(err, emailchange.ErrInvalidToken):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation link"})
+		case errors.Is(err, emailchange.ErrEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not change email"})
+		}
+		return
+	}
+
+	log.Printf("User %d changed email from %s to %s", user.ID, oldEmail, user.Email)
+	c.JSON(http.StatusOK, gin.H{"message": "Email changed successfully"})
+}
@@ -1,11 +1,24 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"time"
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/dto"
+	"digital-library/backend/internal/holdings"
 	"digital-library/backend/internal/models"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errBookNotFound     = errors.New("book not found")
+	errCopyNotFound     = errors.New("copy not found")
+	errCopyMismatch     = errors.New("copy belongs to another book")
+	errCopyNotAvailable = errors.New("no copy is available")
+	errLoanReturned     = errors.New("loan has already been returned")
 )
 
 type LoanController struct {
@@ -14,47 +27,152 @@ type LoanController struct {
 
 // Checkout a book
 func (lc *LoanController) CheckoutBook(c *gin.Context) {
-	var input struct {
-		BookID uint   `json:"book_id" binding:"required"`
-		UserID uint   `json:"user_id" binding:"required"`
-		Days   int    `json:"loan_days" binding:"required"` // Loan duration
-	}
+	var input dto.CheckoutRequest
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Verify book exists and is available
-	var book models.Book
-	if err := lc.DB.First(&book, input.BookID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	// Patrons borrow for themselves; only desk staff lend to someone else
+	userID, _ := c.Get("userID")
+	callerID, _ := userID.(uint)
+	if input.UserID == 0 {
+		input.UserID = callerID
+	}
+	if input.UserID != callerID && !callerHasAny(c, "lookup_patrons", "manage_users") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You may only check out books for yourself"})
 		return
 	}
 
-	if book.Status != "AVAILABLE" {
-		c.JSON(http.StatusConflict, gin.H{"error": "Book is not available"})
+	// Suspended or deactivated accounts may neither borrow nor lend
+	var caller models.User
+	if err := lc.DB.First(&caller, callerID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	if !caller.CanBorrow() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":          "Your account may not check out books",
+			"account_status": dto.NewAccountStatus(caller),
+		})
 		return
 	}
 
-	// Create loan
-	loan := models.Loan{
-		UserID:      input.UserID,
-		BookID:      input.BookID,
-		CheckoutDate: time.Now(),
-		DueDate:     time.Now().AddDate(0, 0, input.Days),
-		Status:      "ACTIVE",
+	patron := caller
+	if input.UserID != callerID {
+		if err := lc.DB.First(&patron, input.UserID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if !patron.CanBorrow() {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":          "Patron may not borrow books",
+				"account_status": dto.NewAccountStatus(patron),
+			})
+			return
+		}
 	}
 
-	if err := lc.DB.Create(&loan).Error; err != nil {
+	var loan models.Loan
+	err := lc.DB.Transaction(func(tx *gorm.DB) error {
+		item, err := findCopyToLend(tx, input)
+		if err != nil {
+			return err
+		}
+
+		// Only take the copy off the shelf if it is still there, so that two
+		// desks cannot lend out the same copy
+		result := tx.Model(&item).Where("status = ?", models.CopyAvailable).Update("status", models.CopyCheckedOut)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errCopyNotAvailable
+		}
+
+		loan = models.Loan{
+			UserID:       input.UserID,
+			BookID:       item.BookID,
+			CopyID:       item.ID,
+			CheckoutDate: time.Now(),
+			DueDate:      time.Now().AddDate(0, 0, input.Days),
+			Status:       "ACTIVE",
+		}
+		if err := tx.Create(&loan).Error; err != nil {
+			return err
+		}
+		loan.Copy = item
+		return holdings.Refresh(tx, item.BookID)
+	})
+	switch {
+	case errors.Is(err, errBookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		return
+	case errors.Is(err, errCopyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Copy not found"})
+		return
+	case errors.Is(err, errCopyMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Copy is not a copy of the given book"})
+		return
+	case errors.Is(err, errCopyNotAvailable) && (input.CopyID != 0 || input.Barcode != ""):
+		c.JSON(http.StatusConflict, gin.H{"error": "Copy is not available"})
+		return
+	case errors.Is(err, errCopyNotAvailable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Book is not available"})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create loan"})
 		return
 	}
 
-	// Update book status
-	lc.DB.Model(&book).Update("status", "CHECKED_OUT")
+	lc.DB.First(&loan.Book, loan.BookID)
+	c.JSON(http.StatusCreated, dto.NewLoanResponse(loan))
+}
+
+// callerHasAny reports whether the authenticated caller holds at least one
+// of the permissions.
+func callerHasAny(c *gin.Context, permissions ...string) bool {
+	value, _ := c.Get("permissions")
+	granted, ok := value.(authz.PermissionSet)
+	return ok && granted.HasAny(permissions...)
+}
+
+// findCopyToLend resolves the checkout request to a copy: the one given by
+// ID or barcode, or else the first copy of the book on the shelf. Copies
+// another checkout has locked are skipped, so that losing a race for one
+// copy still lends out the next.
+func findCopyToLend(tx *gorm.DB, input dto.CheckoutRequest) (models.Copy, error) {
+	var item models.Copy
+	query := tx
+	switch {
+	case input.CopyID != 0:
+		query = query.Where("id = ?", input.CopyID)
+	case input.Barcode != "":
+		query = query.Where("barcode = ?", input.Barcode)
+	default:
+		var book models.Book
+		if err := tx.First(&book, input.BookID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return item, errBookNotFound
+		} else if err != nil {
+			return item, err
+		}
+		query = query.Where("book_id = ? AND status = ?", book.ID, models.CopyAvailable).Order("id").
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+	}
 
-	c.JSON(http.StatusCreated, loan)
+	err := query.First(&item).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound) && input.CopyID == 0 && input.Barcode == "":
+		return item, errCopyNotAvailable
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return item, errCopyNotFound
+	case err != nil:
+		return item, err
+	case input.BookID != 0 && item.BookID != input.BookID:
+		return item, errCopyMismatch
+	}
+	return item, nil
 }
 
 // Return a book
@@ -62,7 +180,7 @@ func (lc *LoanController) ReturnBook(c *gin.Context) {
 	loanID := c.Param("id")
 
 	var loan models.Loan
-	if err := lc.DB.Preload("Book").First(&loan, loanID).Error; err != nil {
+	if err := lc.DB.Preload("Book").Preload("Copy").First(&loan, loanID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
 		return
 	}
@@ -72,15 +190,34 @@ func (lc *LoanController) ReturnBook(c *gin.Context) {
 	loan.ReturnDate = &returnTime
 	loan.Status = "RETURNED"
 
-	if err := lc.DB.Save(&loan).Error; err != nil {
+	err := lc.DB.Transaction(func(tx *gorm.DB) error {
+		// Only return the loan once, even if two returns race
+		result := tx.Model(&models.Loan{}).Where("id = ? AND return_date IS NULL", loan.ID).
+			Updates(map[string]interface{}{"return_date": returnTime, "status": loan.Status})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errLoanReturned
+		}
+		// Put the copy back on the shelf
+		if loan.CopyID != 0 {
+			if err := tx.Model(&loan.Copy).Update("status", models.CopyAvailable).Error; err != nil {
+				return err
+			}
+		}
+		return holdings.Refresh(tx, loan.BookID)
+	})
+	if errors.Is(err, errLoanReturned) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Loan has already been returned"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update loan"})
 		return
 	}
 
-	// Update book status
-	lc.DB.Model(&loan.Book).Update("status", "AVAILABLE")
-
-	c.JSON(http.StatusOK, loan)
+	c.JSON(http.StatusOK, dto.NewLoanResponse(loan))
 }
 
 // Get user's active loans
@@ -88,25 +225,25 @@ func (lc *LoanController) GetUserLoans(c *gin.Context) {
 	userID := c.Param("user_id")
 
 	var loans []models.Loan
-	if err := lc.DB.Preload("Book").
+	if err := lc.DB.Preload("Book").Preload("Copy").
 		Where("user_id = ? AND status = ?", userID, "ACTIVE").
 		Find(&loans).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch loans"})
 		return
 	}
 
-	c.JSON(http.StatusOK, loans)
+	c.JSON(http.StatusOK, dto.NewLoanResponses(loans))
 }
 
 // Get overdue loans
 func (lc *LoanController) GetOverdueLoans(c *gin.Context) {
 	var loans []models.Loan
-	if err := lc.DB.Preload("Book").Preload("User").
+	if err := lc.DB.Preload("Book").Preload("Copy").Preload("User").
 		Where("due_date < ? AND status = ?", time.Now(), "ACTIVE").
 		Find(&loans).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch overdue loans"})
 		return
 	}
 
-	c.JSON(http.StatusOK, loans)
+	c.JSON(http.StatusOK, dto.NewLoanResponses(loans))
 }
\ No newline at end of file
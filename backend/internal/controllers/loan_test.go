@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/testdb"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// loanFixture is a database with one book, the given number of copies of it
+// on the shelf and as many patrons as asked for, and a router serving
+// checkouts as whichever patron the X-User header names.
+type loanFixture struct {
+	db      *gorm.DB
+	router  *gin.Engine
+	book    models.Book
+	copies  []models.Copy
+	patrons []models.User
+}
+
+func newLoanFixture(t *testing.T, copies, patrons int) *loanFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db := testdb.Open(t, &models.User{}, &models.Category{}, &models.Book{}, &models.Copy{}, &models.Loan{})
+	f := &loanFixture{db: db}
+
+	category := models.Category{Name: "Fiction"}
+	if err := db.Create(&category).Error; err != nil {
+		t.Fatal(err)
+	}
+	f.book = models.Book{Title: "Dune", Author: "Herbert", ISBN: "1", CategoryID: category.ID, Status: models.BookAvailable}
+	if err := db.Create(&f.book).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < copies; i++ {
+		item := models.Copy{BookID: f.book.ID, Barcode: fmt.Sprintf("C%03d", i), Status: models.CopyAvailable}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatal(err)
+		}
+		f.copies = append(f.copies, item)
+	}
+	for i := 0; i < patrons; i++ {
+		patron := models.User{Username: fmt.Sprintf("patron%d", i), Email: fmt.Sprintf("patron%d@example.com", i), Password: "hash", Status: models.UserActive}
+		if err := db.Create(&patron).Error; err != nil {
+			t.Fatal(err)
+		}
+		f.patrons = append(f.patrons, patron)
+	}
+
+	lc := &LoanController{DB: db}
+	f.router = gin.New()
+	f.router.POST("/loans", func(c *gin.Context) {
+		var userID uint
+		fmt.Sscan(c.GetHeader("X-User"), &userID)
+		c.Set("userID", userID)
+		c.Set("permissions", authz.PermissionSet{"borrow_books": true})
+	}, lc.CheckoutBook)
+	return f
+}
+
+func (f *loanFixture) checkout(patron models.User, body map[string]interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/loans", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User", fmt.Sprint(patron.ID))
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+// checkoutConcurrently has every patron check out at once and returns the
+// response status codes.
+func (f *loanFixture) checkoutConcurrently(body map[string]interface{}) map[int]int {
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		codes = map[int]int{}
+	)
+	for _, patron := range f.patrons {
+		wg.Add(1)
+		go func(patron models.User) {
+			defer wg.Done()
+			w := f.checkout(patron, body)
+			mu.Lock()
+			codes[w.Code]++
+			mu.Unlock()
+		}(patron)
+	}
+	wg.Wait()
+	return codes
+}
+
+func (f *loanFixture) activeLoans(t *testing.T) []models.Loan {
+	t.Helper()
+	var loans []models.Loan
+	if err := f.db.Where("return_date IS NULL").Find(&loans).Error; err != nil {
+		t.Fatal(err)
+	}
+	return loans
+}
+
+func TestConcurrentCheckoutLendsTheLastCopyOnce(t *testing.T) {
+	f := newLoanFixture(t, 1, 8)
+
+	codes := f.checkoutConcurrently(map[string]interface{}{"book_id": f.book.ID, "loan_days": 14})
+	if codes[http.StatusCreated] != 1 || codes[http.StatusConflict] != 7 {
+		t.Fatalf("responses = %v, want one 201 and seven 409", codes)
+	}
+
+	if loans := f.activeLoans(t); len(loans) != 1 || loans[0].CopyID != f.copies[0].ID {
+		t.Errorf("active loans = %+v, want one of copy %d", loans, f.copies[0].ID)
+	}
+	var item models.Copy
+	f.db.First(&item, f.copies[0].ID)
+	if item.Status != models.CopyCheckedOut {
+		t.Errorf("copy status = %s, want %s", item.Status, models.CopyCheckedOut)
+	}
+	var book models.Book
+	f.db.First(&book, f.book.ID)
+	if book.Status != models.BookCheckedOut {
+		t.Errorf("book status = %s, want %s", book.Status, models.BookCheckedOut)
+	}
+}
+
+func TestConcurrentCheckoutOfABarcodeLendsItOnce(t *testing.T) {
+	f := newLoanFixture(t, 2, 6)
+
+	codes := f.checkoutConcurrently(map[string]interface{}{"barcode": f.copies[1].Barcode, "loan_days": 14})
+	if codes[http.StatusCreated] != 1 || codes[http.StatusConflict] != 5 {
+		t.Fatalf("responses = %v, want one 201 and five 409", codes)
+	}
+	if loans := f.activeLoans(t); len(loans) != 1 || loans[0].CopyID != f.copies[1].ID {
+		t.Errorf("active loans = %+v, want one of copy %d", loans, f.copies[1].ID)
+	}
+
+	// The other copy is still on the shelf
+	var book models.Book
+	f.db.First(&book, f.book.ID)
+	if book.Status != models.BookAvailable {
+		t.Errorf("book status = %s, want %s", book.Status, models.BookAvailable)
+	}
+}
+
+func TestConcurrentCheckoutLendsEachCopyOnce(t *testing.T) {
+	f := newLoanFixture(t, 3, 5)
+
+	codes := f.checkoutConcurrently(map[string]interface{}{"book_id": f.book.ID, "loan_days": 14})
+	if codes[http.StatusCreated] != 3 || codes[http.StatusConflict] != 2 {
+		t.Fatalf("responses = %v, want three 201 and two 409", codes)
+	}
+
+	lent := map[uint]bool{}
+	for _, loan := range f.activeLoans(t) {
+		if lent[loan.CopyID] {
+			t.Errorf("copy %d lent twice", loan.CopyID)
+		}
+		lent[loan.CopyID] = true
+	}
+	if len(lent) != 3 {
+		t.Errorf("%d copies lent, want 3", len(lent))
+	}
+}
+
+func TestCheckoutForAnotherPatronNeedsDeskStaff(t *testing.T) {
+	f := newLoanFixture(t, 1, 2)
+
+	w := f.checkout(f.patrons[0], map[string]interface{}{"book_id": f.book.ID, "loan_days": 14, "user_id": f.patrons[1].ID})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("checkout for someone else = %d, want 403: %s", w.Code, w.Body)
+	}
+	if loans := f.activeLoans(t); len(loans) != 0 {
+		t.Errorf("%d loans created, want none", len(loans))
+	}
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"digital-library/backend/internal/magiclink"
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/tokens"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RequestMagicLink emails a single-use sign-in link. The response is the
+// same whether or not the address belongs to an account.
+func (ac *AuthController) RequestMagicLink(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Every request counts against the address, known or not, so the limit
+	// neither floods an inbox nor reveals which addresses exist
+	key := "magic-link:" + strings.ToLower(strings.TrimSpace(input.Email))
+	status, err := ac.MagicLinkLimiter.Check(key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check sign-in link requests"})
+		return
+	}
+	if !status.Allowed() {
+		c.Header("Retry-After", strconv.Itoa(int(status.RetryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many sign-in link requests, please try again later"})
+		return
+	}
+	if _, _, err := ac.MagicLinkLimiter.Fail(key); err != nil {
+		log.Printf("Failed to record sign-in link request: %v", err)
+	}
+
+	response := gin.H{"message": "If this email exists, a sign-in link has been sent"}
+
+	var user models.User
+	if err := ac.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	token, err := ac.MagicLinks.Create(user.ID, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sign-in link"})
+		return
+	}
+
+	go func() {
+		if err := ac.Email.SendMagicLinkEmail(user.Email, token, ac.MagicLinks.TTL()); err != nil {
+			log.Printf("Failed to send magic link email: %v", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, response)
+}
+
+// magicLinkPage asks the user to confirm signing in. Mail scanners and link
+// previews follow links with GET, so opening the link must not use it up.
+var magicLinkPage = template.Must(template.New("magic-link").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+<form method="post" action="/auth/magic-link/verify">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Sign in to the Digital Library</button>
+</form>
+</body>
+</html>
+`))
+
+// ShowMagicLink shows the page confirming a sign-in link, without using it
+func (ac *AuthController) ShowMagicLink(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in token is required"})
+		return
+	}
+
+	var page bytes.Buffer
+	if err := magicLinkPage.Execute(&page, token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not show sign-in page"})
+		return
+	}
+	// Keep the token out of caches and of the Referer of anything loaded
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+// ConsumeMagicLink signs the user in with the token from a sign-in link,
+// posted by the confirmation page as a form or by a client as JSON
+func (ac *AuthController) ConsumeMagicLink(c *gin.Context) {
+	var input struct {
+		Token string `form:"token" json:"token" binding:"required"`
+	}
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in token is required"})
+		return
+	}
+
+	user, err := ac.MagicLinks.Consume(input.Token)
+	if err != nil {
+		if errors.Is(err, magiclink.ErrInvalidLink) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired sign-in link"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not sign in"})
+		return
+	}
+
+	// The link replaces the password, not the second factor
+	if user.TOTPEnabled {
+		challenge, err := ac.MFA.CreateChallenge(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start two-factor login"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required":    true,
+			"challenge_token": challenge,
+		})
+		return
+	}
+
+	pair, err := ac.Tokens.Issue(*user, tokens.Client{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	})
+	if err != nil {
+		respondIssueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pair)
+}
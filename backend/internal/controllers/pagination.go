@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Page sizes for list endpoints
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pagination is a page of a list, as requested with ?page=&page_size=
+type pagination struct {
+	Page     int
+	PageSize int
+}
+
+// parsePagination reads the page and page size from the query string,
+// responding with an error and returning false if they are invalid
+func parsePagination(c *gin.Context) (pagination, bool) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive number"})
+		return pagination{}, false
+	}
+	pageSize, ok := parsePageSize(c)
+	if !ok {
+		return pagination{}, false
+	}
+	return pagination{Page: page, PageSize: pageSize}, true
+}
+
+func parsePageSize(c *gin.Context) (int, bool) {
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page_size must be between 1 and " + strconv.Itoa(maxPageSize)})
+		return 0, false
+	}
+	return pageSize, true
+}
+
+// apply limits the query to the requested page
+func (p pagination) apply(query *gorm.DB) *gorm.DB {
+	return query.Offset((p.Page - 1) * p.PageSize).Limit(p.PageSize)
+}
+
+// setHeaders reports the number of matching records across all pages and
+// links to the first, previous, next and last pages
+func (p pagination) setHeaders(c *gin.Context, total int64) {
+	setTotalCount(c, total)
+
+	last := int((total + int64(p.PageSize) - 1) / int64(p.PageSize))
+	if last < 1 {
+		last = 1
+	}
+	pageLink := func(rel string, page int) string {
+		return listLink(c, rel, map[string]string{"page": strconv.Itoa(page)})
+	}
+
+	links := []string{pageLink("first", 1)}
+	if p.Page > 1 {
+		links = append(links, pageLink("prev", min(p.Page-1, last)))
+	}
+	if p.Page < last {
+		links = append(links, pageLink("next", p.Page+1))
+	}
+	links = append(links, pageLink("last", last))
+	c.Header("Link", strings.Join(links, ", "))
+}
+
+// setTotalCount reports the number of matching records across all pages
+func setTotalCount(c *gin.Context, total int64) {
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+}
+
+// listLink formats a Link header entry for the current list with some query
+// parameters replaced
+func listLink(c *gin.Context, rel string, params map[string]string) string {
+	link := *c.Request.URL
+	query := link.Query()
+	for name, value := range params {
+		query.Set(name, value)
+	}
+	link.RawQuery = query.Encode()
+	return fmt.Sprintf(`<%s>; rel="%s"`, link.RequestURI(), rel)
+}
+
+// sortField is a field a list of T may be sorted by: its column, and how to
+// read its value from a row for a cursor
+type sortField[T any] struct {
+	Column string
+	Value  func(T) interface{}
+}
+
+type sortKey[T any] struct {
+	sortField[T]
+	Desc bool
+}
+
+// sortOrder is the order a list was requested in, as given by ?sort=
+type sortOrder[T any] struct {
+	Spec string
+	Keys []sortKey[T]
+}
+
+// parseSort reads ?sort=, a comma-separated list of field names each
+// optionally prefixed with "-" for descending order. The "id" field always
+// comes last so that rows with equal values keep a stable order.
+func parseSort[T any](c *gin.Context, fields map[string]sortField[T], def string) (sortOrder[T], bool) {
+	order := sortOrder[T]{Spec: c.DefaultQuery("sort", def)}
+	seen := map[string]bool{}
+	for _, name := range strings.Split(order.Spec, ",") {
+		name = strings.TrimSpace(name)
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		field, ok := fields[name]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cannot sort by %q", name)})
+			return order, false
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		order.Keys = append(order.Keys, sortKey[T]{sortField: field, Desc: desc})
+	}
+	if !seen["id"] {
+		order.Keys = append(order.Keys, sortKey[T]{sortField: fields["id"]})
+	}
+	return order, true
+}
+
+// apply orders the query
+func (o sortOrder[T]) apply(query *gorm.DB) *gorm.DB {
+	for _, key := range o.Keys {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: key.Column}, Desc: key.Desc})
+	}
+	return query
+}
+
+// errInvalidCursor is returned for a cursor that was tampered with or was
+// issued for a different sort order
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursor marks the last row of a page by its sort values, and the sort order
+// they belong to
+type cursor struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+// encodeCursor returns the cursor continuing after row
+func (o sortOrder[T]) encodeCursor(row T) string {
+	values := make([]json.RawMessage, 0, len(o.Keys))
+	for _, key := range o.Keys {
+		value, _ := json.Marshal(key.Value(row))
+		values = append(values, value)
+	}
+	data, _ := json.Marshal(cursor{Sort: o.Spec, Values: values})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// after limits the query to rows following the cursor. Mixed sort directions
+// rule out a row comparison, so the condition is spelled out column by
+// column: (a > ?) OR (a = ? AND b > ?) OR ...
+func (o sortOrder[T]) after(query *gorm.DB, encoded string) (*gorm.DB, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var position cursor
+	if err := json.Unmarshal(data, &position); err != nil || position.Sort != o.Spec || len(position.Values) != len(o.Keys) {
+		return nil, errInvalidCursor
+	}
+
+	var zero T
+	values := make([]interface{}, len(o.Keys))
+	for i, key := range o.Keys {
+		// Decode into the field's own type so timestamps and numbers are
+		// compared as such
+		target := reflect.New(reflect.TypeOf(key.Value(zero)))
+		if err := json.Unmarshal(position.Values[i], target.Interface()); err != nil {
+			return nil, errInvalidCursor
+		}
+		values[i] = target.Elem().Interface()
+	}
+
+	var conditions []string
+	var args []interface{}
+	for i, key := range o.Keys {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, o.Keys[j].Column+" = ?")
+			args = append(args, values[j])
+		}
+		operator := ">"
+		if key.Desc {
+			operator = "<"
+		}
+		parts = append(parts, key.Column+" "+operator+" ?")
+		args = append(args, values[i])
+		conditions = append(conditions, "("+strings.Join(parts, " AND ")+")")
+	}
+	return query.Where(strings.Join(conditions, " OR "), args...), nil
+}
+
+// likePattern turns user input into an ILIKE pattern matching it anywhere,
+// with the input's own wildcards escaped
+func likePattern(s string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + escaped + "%"
+}
+
+// splitQuery reads a comma-separated query parameter, dropping blanks
+func splitQuery(c *gin.Context, name string) []string {
+	var values []string
+	for _, value := range strings.Split(c.Query(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
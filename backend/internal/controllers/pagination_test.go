@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/testdb"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// paginationFixture is a database of books sharing titles, years and
+// creation times, so that pages break between rows with equal sort values.
+func paginationFixture(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := testdb.Open(t, &models.Category{}, &models.Book{})
+
+	category := models.Category{Name: "Fiction"}
+	if err := db.Create(&category).Error; err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	var books []models.Book
+	for i := 0; i < 23; i++ {
+		books = append(books, models.Book{
+			Model:           gorm.Model{CreatedAt: created.Add(time.Duration(i%4) * time.Hour)},
+			Title:           fmt.Sprintf("Title %d", i%5),
+			Author:          "Author",
+			ISBN:            fmt.Sprint(1000 + i),
+			PublicationYear: 1990 + i%3,
+			CategoryID:      category.ID,
+		})
+	}
+	if err := db.Create(&books).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func sortFor(t *testing.T, spec string) sortOrder[models.Book] {
+	t.Helper()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/books?sort="+url.QueryEscape(spec), nil)
+	order, ok := parseSort(c, bookSortFields, "title")
+	if !ok {
+		t.Fatalf("parseSort(%q) failed", spec)
+	}
+	return order
+}
+
+func bookIDs(books []models.Book) []uint {
+	ids := make([]uint, 0, len(books))
+	for _, book := range books {
+		ids = append(ids, book.ID)
+	}
+	return ids
+}
+
+func TestCursorPagesCoverEveryRowOnce(t *testing.T) {
+	db := paginationFixture(t)
+
+	for _, spec := range []string{"title", "-title", "-publication_year,title", "publication_year,-id", "-created_at,title"} {
+		t.Run(spec, func(t *testing.T) {
+			order := sortFor(t, spec)
+
+			var all []models.Book
+			if err := order.apply(db.Model(&models.Book{})).Find(&all).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			var walked []models.Book
+			position := ""
+			for pages := 0; ; pages++ {
+				if pages > len(all) {
+					t.Fatal("pagination does not end")
+				}
+				query := db.Model(&models.Book{})
+				if position != "" {
+					var err error
+					if query, err = order.after(query, position); err != nil {
+						t.Fatalf("after(%q): %v", position, err)
+					}
+				}
+				var page []models.Book
+				if err := order.apply(query).Limit(4).Find(&page).Error; err != nil {
+					t.Fatal(err)
+				}
+				if len(page) == 0 {
+					break
+				}
+				walked = append(walked, page...)
+				position = order.encodeCursor(page[len(page)-1])
+			}
+
+			if got, want := bookIDs(walked), bookIDs(all); !reflect.DeepEqual(got, want) {
+				t.Errorf("pages = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCursorStaysValidWhileBooksAreAdded(t *testing.T) {
+	db := paginationFixture(t)
+	order := sortFor(t, "title")
+
+	var first []models.Book
+	if err := order.apply(db.Model(&models.Book{})).Limit(5).Find(&first).Error; err != nil {
+		t.Fatal(err)
+	}
+	position := order.encodeCursor(first[len(first)-1])
+
+	// A book sorting before the cursor does not shift the next page
+	early := models.Book{Title: "A title", Author: "Author", ISBN: "9999", CategoryID: first[0].CategoryID}
+	if err := db.Create(&early).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	query, err := order.after(db.Model(&models.Book{}), position)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var next []models.Book
+	if err := order.apply(query).Limit(5).Find(&next).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var want []models.Book
+	if err := order.apply(db.Model(&models.Book{}).Where("id <> ?", early.ID)).Offset(5).Limit(5).Find(&want).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bookIDs(next), bookIDs(want); !reflect.DeepEqual(got, want) {
+		t.Errorf("next page = %v, want %v", got, want)
+	}
+}
+
+func TestInvalidCursorsAreRejected(t *testing.T) {
+	db := paginationFixture(t)
+	byTitle := sortFor(t, "title")
+	byYear := sortFor(t, "-publication_year")
+	book := models.Book{Model: gorm.Model{ID: 3}, Title: "Title 3"}
+
+	for name, position := range map[string]string{
+		"not base64":       "%%%",
+		"not json":         "bm90IGpzb24",
+		"other sort":       byYear.encodeCursor(book),
+		"too few values":   "eyJzIjoidGl0bGUiLCJ2IjpbIlRpdGxlIDMiXX0",
+		"wrong value type": "eyJzIjoidGl0bGUiLCJ2IjpbIlRpdGxlIDMiLCJ0aHJlZSJdfQ",
+	} {
+		if _, err := byTitle.after(db, position); err != errInvalidCursor {
+			t.Errorf("%s: err = %v, want errInvalidCursor", name, err)
+		}
+	}
+
+	if _, err := byTitle.after(db, byTitle.encodeCursor(book)); err != nil {
+		t.Errorf("own cursor: %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/dto"
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/passwords"
+	"digital-library/backend/internal/tokens"
+	"digital-library/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ProfileController serves the signed-in user's own account under /me
+type ProfileController struct {
+	DB        *gorm.DB
+	Tokens    *tokens.Service
+	Passwords *passwords.Policy
+	Authz     *authz.Service
+}
+
+// loadCurrentUser fetches the signed-in user with roles, responding with an
+// error and returning false if that fails
+func (pc *ProfileController) loadCurrentUser(c *gin.Context) (*models.User, bool) {
+	userID, _ := c.Get("userID")
+
+	var user models.User
+	if err := pc.DB.Preload("Roles").First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// GetMe returns the signed-in user's profile
+func (pc *ProfileController) GetMe(c *gin.Context) {
+	user, ok := pc.loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewUserResponse(*user))
+}
+
+// UpdateMe changes the fields users may edit on their own profile. The body
+// is a JSON merge patch: fields left out are kept, null clears a field, and
+// preferences are merged key by key.
+func (pc *ProfileController) UpdateMe(c *gin.Context) {
+	user, ok := pc.loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	var input dto.ProfileUpdateRequest
+	if !bindUpdate(c, dto.NewProfileUpdateRequest(*user), &input) {
+		return
+	}
+
+	// Updating from the struct, limited to the editable columns, lets the
+	// JSON serializer encode preferences
+	input.Apply(user)
+	if err := pc.DB.Model(user).Select(dto.ProfileColumns).Updates(user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewUserResponse(*user))
+}
+
+// ChangePassword replaces the signed-in user's password after checking the
+// current one, and logs out every other session
+func (pc *ProfileController) ChangePassword(c *gin.Context) {
+	var input struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := pc.loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if !utils.CheckPasswordHash(input.CurrentPassword, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	violations, err := pc.Passwords.Check(*user, input.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check password"})
+		return
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      "Password does not meet the password policy",
+			"violations": violations,
+		})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	err = pc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := pc.Passwords.Remember(tx, user.ID, user.Password); err != nil {
+			return err
+		}
+		return tx.Model(user).Updates(map[string]interface{}{
+			"password":                hashedPassword,
+			"password_reset_required": false,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	sessionID, _ := c.Get("sessionID")
+	if err := pc.Tokens.RevokeOthers(user.ID, sessionID.(uint)); err != nil {
+		log.Printf("Failed to revoke sessions after password change: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// ExportMe returns everything the library stores about the signed-in user
+// as a downloadable JSON document
+func (pc *ProfileController) ExportMe(c *gin.Context) {
+	user, ok := pc.loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	export, err := pc.export(*user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not export account data"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="account-%d.json"`, user.ID))
+	c.JSON(http.StatusOK, export)
+}
+
+// DeleteMe closes the signed-in user's account after checking the password.
+// Personal data is erased and the export is returned one last time; loan
+// history is kept, detached from any identifying details.
+func (pc *ProfileController) DeleteMe(c *gin.Context) {
+	var input struct {
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := pc.loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if !utils.CheckPasswordHash(input.Password, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	var activeLoans int64
+	if err := pc.DB.Model(&models.Loan{}).Where("user_id = ? AND status = ?", user.ID, "ACTIVE").Count(&activeLoans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if activeLoans > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Return all borrowed books before deleting your account"})
+		return
+	}
+
+	export, err := pc.export(*user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not export account data"})
+		return
+	}
+
+	if err := pc.erase(*user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete account"})
+		return
+	}
+	pc.Authz.Invalidate(user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Account deleted",
+		"export":  export,
+	})
+}
+
+func (pc *ProfileController) export(user models.User) (*dto.AccountExport, error) {
+	var loans []models.Loan
+	if err := pc.DB.Preload("Book").Preload("Copy").Where("user_id = ?", user.ID).Order("checkout_date DESC").Find(&loans).Error; err != nil {
+		return nil, err
+	}
+
+	var sessions []models.Session
+	if err := pc.DB.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	var keys []models.APIKey
+	if err := pc.DB.Where("user_id = ?", user.ID).Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	var identities []models.ExternalIdentity
+	if err := pc.DB.Where("user_id = ?", user.ID).Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	identityData := make([]dto.ExternalIdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		identityData = append(identityData, dto.ExternalIdentityResponse{
+			Provider: identity.Provider,
+			Email:    identity.Email,
+			LinkedAt: identity.CreatedAt,
+		})
+	}
+
+	return &dto.AccountExport{
+		ExportedAt:         time.Now(),
+		Profile:            dto.NewUserResponse(user),
+		Loans:              dto.NewLoanResponses(loans),
+		Sessions:           dto.NewSessionResponses(sessions, 0),
+		APIKeys:            dto.NewAPIKeyResponses(keys),
+		ExternalIdentities: identityData,
+	}, nil
+}
+
+// releasedIdentifiers replaces the username, email and card number of a
+// deleted account, so that all three can be taken by a new one.
+func releasedIdentifiers(userID uint) map[string]interface{} {
+	placeholder := fmt.Sprintf("deleted-user-%d", userID)
+	return map[string]interface{}{
+		"username":    placeholder,
+		"email":       placeholder + "@deleted.invalid",
+		"card_number": gorm.Expr("NULL"),
+	}
+}
+
+// erase removes the user's credentials, sessions and personal data, including
+// the uploaded profile photo, and soft-deletes the account. Username and email
+// are replaced so both can be reused.
+func (pc *ProfileController) erase(user models.User) error {
+	secret, err := utils.GenerateVerificationToken()
+	if err != nil {
+		return err
+	}
+	unusable, err := utils.HashPassword(secret)
+	if err != nil {
+		return err
+	}
+
+	return pc.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&models.RefreshToken{}, &models.Session{}, &models.APIKey{}, &models.RecoveryCode{}, &models.MFAChallenge{},
+			&models.ExternalIdentity{}, &models.PasswordHistory{}, &models.OneTimeToken{}, &models.EmailChange{},
+		} {
+			if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&user).Association("Roles").Clear(); err != nil {
+			return err
+		}
+
+		columns := releasedIdentifiers(user.ID)
+		for column, value := range map[string]interface{}{
+			"password":       unusable,
+			"profile_photo":  "",
+			"display_name":   "",
+			"phone":          "",
+			"preferences":    gorm.Expr("NULL"),
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		} {
+			columns[column] = value
+		}
+		if err := tx.Model(&user).Updates(columns).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+
+		// Last, so that failing to remove the file leaves the account as it was
+		if user.ProfilePhoto != "" {
+			err := os.Remove(filepath.Join(uploadDir, filepath.Base(user.ProfilePhoto)))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/onetime"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ResendVerification sends a fresh verification link to an unverified
+// account. The response is the same whether or not the address belongs to
+// an account, or the account is already verified.
+func (ac *AuthController) ResendVerification(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The cooldown applies to every address, known or not
+	key := "verify:" + strings.ToLower(strings.TrimSpace(input.Email))
+	status, err := ac.VerificationLimiter.Check(key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check verification requests"})
+		return
+	}
+	if !status.Allowed() {
+		c.Header("Retry-After", strconv.Itoa(int(status.RetryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait before requesting another verification email"})
+		return
+	}
+	if _, _, err := ac.VerificationLimiter.Fail(key); err != nil {
+		log.Printf("Failed to record verification request: %v", err)
+	}
+
+	response := gin.H{"message": "If this email belongs to an unverified account, a verification link has been sent"}
+
+	var user models.User
+	if err := ac.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if user.IsVerified {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// Issuing a new token invalidates the earlier links
+	token, err := ac.OneTimeTokens.Issue(user.ID, onetime.PurposeVerifyEmail, verifyEmailTTL, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate verification token"})
+		return
+	}
+
+	go func() {
+		if err := ac.Email.SendVerificationEmail(user.Email, token); err != nil {
+			log.Printf("Failed to send verification email: %v", err)
+		}
+	}()
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,374 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/dto"
+	"digital-library/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// builtinRoles are relied on by the application itself: new accounts get
+// "user", and the seeded administrator "admin".
+var builtinRoles = map[string]bool{"user": true, "admin": true}
+
+// errLastUserManager is returned when a change would leave no user able to
+// manage users, and so nobody able to undo it.
+var errLastUserManager = errors.New("no user would be left with manage_users")
+
+type RoleController struct {
+	DB    *gorm.DB
+	Authz *authz.Service
+}
+
+func (rc *RoleController) GetRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := rc.DB.Preload("Permissions").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch roles"})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewRoleResponses(roles))
+}
+
+func (rc *RoleController) GetRole(c *gin.Context) {
+	var role models.Role
+	if err := rc.DB.Preload("Permissions").First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewRoleResponse(role))
+}
+
+func (rc *RoleController) CreateRole(c *gin.Context) {
+	var input dto.RoleRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	permissions, err := rc.findPermissions(input.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := models.Role{Name: strings.TrimSpace(input.Name), Permissions: permissions}
+	if err := rc.DB.Create(&role).Error; err != nil {
+		respondRoleWriteError(c, err, "Could not create role")
+		return
+	}
+
+	recordAudit(rc.DB, c, "role.create", "role", role.ID, "created role %q with permissions %v", role.Name, input.Permissions)
+	c.JSON(http.StatusCreated, dto.NewRoleResponse(role))
+}
+
+func (rc *RoleController) UpdateRole(c *gin.Context) {
+	var input dto.RoleRenameRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var role models.Role
+	if err := rc.DB.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if builtinRoles[role.Name] {
+		c.JSON(http.StatusConflict, gin.H{"error": "Built-in roles cannot be renamed"})
+		return
+	}
+
+	oldName := role.Name
+	role.Name = strings.TrimSpace(input.Name)
+	if err := rc.DB.Save(&role).Error; err != nil {
+		respondRoleWriteError(c, err, "Could not update role")
+		return
+	}
+
+	recordAudit(rc.DB, c, "role.rename", "role", role.ID, "renamed role %q to %q", oldName, role.Name)
+
+	rc.DB.Preload("Permissions").First(&role, role.ID)
+	c.JSON(http.StatusOK, dto.NewRoleResponse(role))
+}
+
+func (rc *RoleController) DeleteRole(c *gin.Context) {
+	var role models.Role
+	if err := rc.DB.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if builtinRoles[role.Name] {
+		c.JSON(http.StatusConflict, gin.H{"error": "Built-in roles cannot be deleted"})
+		return
+	}
+
+	err := rc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", role.ID).Error; err != nil {
+			return err
+		}
+		// Hard delete so the unique name can be reused by a new role
+		if err := tx.Unscoped().Delete(&role).Error; err != nil {
+			return err
+		}
+		return ensureUserManager(tx)
+	})
+	if err != nil {
+		respondRoleChangeError(c, err, "Could not delete role")
+		return
+	}
+
+	rc.Authz.InvalidateAll()
+	recordAudit(rc.DB, c, "role.delete", "role", role.ID, "deleted role %q", role.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+// AttachPermissions grants additional permissions to a role.
+func (rc *RoleController) AttachPermissions(c *gin.Context) {
+	var input dto.PermissionsRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var role models.Role
+	if err := rc.DB.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	permissions, err := rc.findPermissions(input.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := rc.DB.Model(&role).Association("Permissions").Append(permissions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not attach permissions"})
+		return
+	}
+
+	rc.Authz.InvalidateAll()
+	recordAudit(rc.DB, c, "role.attach_permissions", "role", role.ID, "attached %v to role %q", input.Permissions, role.Name)
+
+	rc.DB.Preload("Permissions").First(&role, role.ID)
+	c.JSON(http.StatusOK, dto.NewRoleResponse(role))
+}
+
+// DetachPermission removes a single permission from a role.
+func (rc *RoleController) DetachPermission(c *gin.Context) {
+	var role models.Role
+	if err := rc.DB.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	var permission models.Permission
+	if err := rc.DB.Where("name = ?", c.Param("permission")).First(&permission).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Permission not found"})
+		return
+	}
+
+	err := rc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Association("Permissions").Delete(&permission); err != nil {
+			return err
+		}
+		return ensureUserManager(tx)
+	})
+	if err != nil {
+		respondRoleChangeError(c, err, "Could not detach permission")
+		return
+	}
+
+	rc.Authz.InvalidateAll()
+	recordAudit(rc.DB, c, "role.detach_permission", "role", role.ID, "detached %q from role %q", permission.Name, role.Name)
+
+	rc.DB.Preload("Permissions").First(&role, role.ID)
+	c.JSON(http.StatusOK, dto.NewRoleResponse(role))
+}
+
+// AssignRole grants a role to a user.
+func (rc *RoleController) AssignRole(c *gin.Context) {
+	role, user, ok := rc.findRoleAndUser(c)
+	if !ok {
+		return
+	}
+
+	if err := rc.DB.Model(&user).Association("Roles").Append(&role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not assign role"})
+		return
+	}
+
+	rc.Authz.Invalidate(user.ID)
+	recordAudit(rc.DB, c, "role.assign", "user", user.ID, "assigned role %q to user %q", role.Name, user.Username)
+	c.JSON(http.StatusOK, gin.H{"message": "Role assigned successfully"})
+}
+
+// RevokeRole removes a role from a user.
+func (rc *RoleController) RevokeRole(c *gin.Context) {
+	role, user, ok := rc.findRoleAndUser(c)
+	if !ok {
+		return
+	}
+
+	err := rc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Association("Roles").Delete(&role); err != nil {
+			return err
+		}
+		return ensureUserManager(tx)
+	})
+	if err != nil {
+		respondRoleChangeError(c, err, "Could not revoke role")
+		return
+	}
+
+	rc.Authz.Invalidate(user.ID)
+	recordAudit(rc.DB, c, "role.revoke", "user", user.ID, "revoked role %q from user %q", role.Name, user.Username)
+	c.JSON(http.StatusOK, gin.H{"message": "Role revoked successfully"})
+}
+
+func (rc *RoleController) findRoleAndUser(c *gin.Context) (models.Role, models.User, bool) {
+	var role models.Role
+	if err := rc.DB.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return role, models.User{}, false
+	}
+
+	var user models.User
+	if err := rc.DB.First(&user, c.Param("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return role, user, false
+	}
+
+	return role, user, true
+}
+
+// findPermissions loads permissions by name and fails if any of them does not exist.
+func (rc *RoleController) findPermissions(names []string) ([]models.Permission, error) {
+	var permissions []models.Permission
+	if len(names) == 0 {
+		return permissions, nil
+	}
+	if err := rc.DB.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		found[p.Name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, errors.New("unknown permission: " + name)
+		}
+	}
+	return permissions, nil
+}
+
+// ensureUserManager fails with errLastUserManager unless some user who can
+// sign in still holds manage_users. Run it at the end of the transaction making a change.
+func ensureUserManager(tx *gorm.DB) error {
+	var managers int64
+	err := tx.Table("users").
+		Joins("JOIN user_roles ON user_roles.user_id = users.id").
+		Joins("JOIN role_permissions ON role_permissions.role_id = user_roles.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("permissions.name = ? AND users.deleted_at IS NULL", "manage_users").
+		// A deactivation that has lapsed no longer keeps the user out
+		Where("users.status <> ? OR users.status_until <= ?", models.UserDeactivated, time.Now()).
+		Distinct("users.id").
+		Count(&managers).Error
+	if err != nil {
+		return err
+	}
+	if managers == 0 {
+		return errLastUserManager
+	}
+	return nil
+}
+
+// respondRoleChangeError reports a change that would leave nobody able to
+// manage users as a conflict.
+func respondRoleChangeError(c *gin.Context, err error, message string) {
+	if errors.Is(err, errLastUserManager) {
+		c.JSON(http.StatusConflict, gin.H{"error": "At least one user must keep the manage_users permission"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// respondRoleWriteError reports a role name already in use as a conflict.
+func respondRoleWriteError(c *gin.Context, err error, message string) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		c.JSON(http.StatusConflict, gin.H{"error": "A role with this name already exists"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+type PermissionController struct {
+	DB    *gorm.DB
+	Authz *authz.Service
+}
+
+func (pc *PermissionController) GetPermissions(c *gin.Context) {
+	var permissions []models.Permission
+	if err := pc.DB.Order("name").Find(&permissions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch permissions"})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewPermissionResponses(permissions))
+}
+
+func (pc *PermissionController) CreatePermission(c *gin.Context) {
+	var input dto.PermissionRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	permission := models.Permission{Name: strings.TrimSpace(input.Name)}
+	if err := pc.DB.Create(&permission).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Could not create permission"})
+		return
+	}
+
+	recordAudit(pc.DB, c, "permission.create", "permission", permission.ID, "created permission %q", permission.Name)
+	c.JSON(http.StatusCreated, dto.NewPermissionResponse(permission))
+}
+
+func (pc *PermissionController) DeletePermission(c *gin.Context) {
+	var permission models.Permission
+	if err := pc.DB.First(&permission, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Permission not found"})
+		return
+	}
+
+	err := pc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM role_permissions WHERE permission_id = ?", permission.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&permission).Error; err != nil {
+			return err
+		}
+		return ensureUserManager(tx)
+	})
+	if err != nil {
+		respondRoleChangeError(c, err, "Could not delete permission")
+		return
+	}
+
+	pc.Authz.InvalidateAll()
+	recordAudit(pc.DB, c, "permission.delete", "permission", permission.ID, "deleted permission %q", permission.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Permission deleted successfully"})
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"digital-library/backend/internal/mfa"
+	"digital-library/backend/internal/provisioning"
+	"digital-library/backend/internal/sso"
+	"digital-library/backend/internal/tokens"
+	"github.com/gin-gonic/gin"
+)
+
+// ssoCookie carries the browser key of a login or link in progress. It is
+// only sent to the OIDC routes, and only readable by the server.
+const ssoCookie = "oidc_browser_key"
+
+type SSOController struct {
+	SSO    *sso.Service
+	Tokens *tokens.Service
+	MFA    *mfa.Service
+}
+
+// Login redirects the browser to the identity provider
+func (sc *SSOController) Login(c *gin.Context) {
+	authorization, err := sc.SSO.AuthorizationURL(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, sso.ErrDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("OIDC login failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	setSSOCookie(c, authorization.BrowserKey, int(sso.StateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authorization.URL)
+}
+
+// Link starts linking an identity provider account to the signed-in user and
+// returns the provider URL to send the browser to
+func (sc *SSOController) Link(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	id, _ := userID.(uint)
+
+	authorization, err := sc.SSO.LinkURL(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, sso.ErrDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("OIDC link failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	setSSOCookie(c, authorization.BrowserKey, int(sso.StateTTL.Seconds()))
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authorization.URL})
+}
+
+// setSSOCookie stores the browser key, or deletes it with a negative maxAge.
+// SameSite=Lax still sends it on the provider's redirect back to us.
+func setSSOCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoCookie, value, maxAge, "/auth/oidc", "", c.Request.TLS != nil, true)
+}
+
+// Callback handles the identity provider's redirect and issues library
+// tokens, or confirms a link
+func (sc *SSOController) Callback(c *gin.Context) {
+	if errParam := c.Query("error"); errParam != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login was not completed: " + errParam})
+		return
+	}
+
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "state and code are required"})
+		return
+	}
+
+	// Without the cookie the flow was started by another browser: someone
+	// may be trying to sign the user in to, or link, their own account
+	browserKey, _ := c.Cookie(ssoCookie)
+	setSSOCookie(c, "", -1)
+	result, err := sc.SSO.Callback(c.Request.Context(), state, code, browserKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, sso.ErrDisabled):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, sso.ErrInvalidState), errors.Is(err, sso.ErrMissingEmail), errors.Is(err, sso.ErrUnverifiedEmail):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, provisioning.ErrEmailTaken), errors.Is(err, provisioning.ErrIdentityLinked):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Printf("OIDC callback failed: %v", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Single sign-on failed"})
+		}
+		return
+	}
+	if result.User == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Identity provider account linked"})
+		return
+	}
+	user := result.User
+
+	// Users who enabled 2FA still complete the second step
+	if user.TOTPEnabled {
+		challenge, err := sc.MFA.CreateChallenge(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start two-factor login"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required":    true,
+			"challenge_token": challenge,
+		})
+		return
+	}
+
+	pair, err := sc.Tokens.Issue(*user, tokens.Client{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	})
+	if err != nil {
+		respondIssueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pair)
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"digital-library/backend/internal/mfa"
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/tokens"
+	"digital-library/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// EnrollTwoFactor starts TOTP enrollment and returns the secret as an
+// otpauth URI and QR code for the user's authenticator app
+func (ac *AuthController) EnrollTwoFactor(c *gin.Context) {
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+
+	enrollment, err := ac.MFA.Enroll(user)
+	if err != nil {
+		if errors.Is(err, mfa.ErrAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start two-factor enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTwoFactor enables 2FA once the user proves their authenticator works
+func (ac *AuthController) ConfirmTwoFactor(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := ac.MFA.Confirm(user, input.Code)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns 2FA off after checking the password and a code
+func (ac *AuthController) DisableTwoFactor(c *gin.Context) {
+	var input struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !utils.CheckPasswordHash(input.Password, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if err := ac.MFA.Disable(user, input.Code); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+func (ac *AuthController) RegenerateRecoveryCodes(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := ac.currentUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := ac.MFA.RegenerateRecoveryCodes(user, input.Code)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// VerifyTwoFactorLogin completes a login that returned a 2FA challenge
+func (ac *AuthController) VerifyTwoFactorLogin(c *gin.Context) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"` // TOTP or recovery code
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := ac.MFA.CompleteChallenge(input.ChallengeToken, input.Code)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	pair, err := ac.Tokens.Issue(*user, tokens.Client{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	})
+	if err != nil {
+		respondIssueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pair)
+}
+
+// currentUser loads the authenticated user, writing an error response if that fails
+func (ac *AuthController) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := ac.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+func respondTwoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, mfa.ErrInvalidCode), errors.Is(err, mfa.ErrInvalidChallenge):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, mfa.ErrAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, mfa.ErrNotEnrolled), errors.Is(err, mfa.ErrNotEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Two-factor authentication failed"})
+	}
+}
@@ -1,24 +1,78 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strings"
+	"time"
+
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/dto"
+	"digital-library/backend/internal/librarycard"
 	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/onetime"
+	"digital-library/backend/internal/tokens"
+	"digital-library/backend/pkg/email"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
-
 )
+
 type UserController struct {
-	DB *gorm.DB
+	DB            *gorm.DB
+	Email         *email.Service
+	Tokens        *tokens.Service
+	OneTimeTokens *onetime.Service
+	Authz         *authz.Service
+	Cards         *librarycard.Service
 }
+
+// GetUsers lists users a page at a time. q matches username or email,
+// username, email, role and status narrow the list further.
 func (uc *UserController) GetUsers(c *gin.Context) {
+	page, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	query := uc.DB.Model(&models.User{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := likePattern(q)
+		query = query.Where("username ILIKE ? OR email ILIKE ?", pattern, pattern)
+	}
+	if username := strings.TrimSpace(c.Query("username")); username != "" {
+		query = query.Where("username ILIKE ?", likePattern(username))
+	}
+	if address := strings.TrimSpace(c.Query("email")); address != "" {
+		query = query.Where("email ILIKE ?", likePattern(address))
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("id IN (SELECT user_roles.user_id FROM user_roles JOIN roles ON roles.id = user_roles.role_id WHERE roles.name = ? AND roles.deleted_at IS NULL)", role)
+	}
+	// Restrictions whose end date has passed count as active
+	if status := strings.ToUpper(c.Query("status")); status == models.UserActive {
+		query = query.Where("status = ? OR status_until <= ?", models.UserActive, time.Now())
+	} else if status != "" {
+		query = query.Where("status = ? AND (status_until IS NULL OR status_until > ?)", status, time.Now())
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch users"})
+		return
+	}
+
 	var users []models.User
-	if err := uc.DB.Preload("Roles").Find(&users).Error; err != nil {
+	if err := page.apply(query).Preload("Roles").Order("id").Find(&users).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch users"})
 		return
 	}
-	c.JSON(http.StatusOK, users)
-	
+
+	page.setHeaders(c, total)
+	c.JSON(http.StatusOK, dto.NewUserResponses(users))
 }
+
 func (uc *UserController) GetUser(c *gin.Context) {
 	id := c.Param("id")
 	var user models.User
@@ -26,40 +80,204 @@ func (uc *UserController) GetUser(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, dto.NewUserResponse(user))
 }
 
+// UpdateUser replaces a user's editable fields (PUT) or changes some of them
+// with a JSON merge patch (PATCH)
 func (uc *UserController) UpdateUser(c *gin.Context) {
 	id := c.Param("id")
 	var user models.User
-	if err := uc.DB.First(&user, id).Error; err != nil {
+	if err := uc.DB.Preload("Roles").First(&user, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+	var input dto.UserUpdateRequest
+	if !bindUpdate(c, dto.NewUserUpdateRequest(user), &input) {
 		return
 	}
-	if err := uc.DB.Save(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update user"})
+
+	input.Apply(&user)
+	if err := uc.DB.Model(&user).Select(dto.UserColumns).Updates(&user).Error; err != nil {
+		respondUserWriteError(c, err, "Could not update user")
 		return
 	}
-	c.JSON(http.StatusOK, user)
-} 
+	c.JSON(http.StatusOK, dto.NewUserResponse(user))
+}
 
+// DeleteUser soft-deletes an account, ends its sessions and frees its
+// username, email and card number. Loans and audit entries keep referring
+// to it. Nobody can delete their own account here, nor the last user able
+// to manage users
 func (uc *UserController) DeleteUser(c *gin.Context) {
-	id := c.Param("id")
-	var user models.User
-	if err := uc.DB.First(&user, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	user, ok := uc.findUser(c)
+	if !ok {
 		return
 	}
-	if err := uc.DB.Delete(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete user"})
+	if actorID, _ := c.Get("userID"); actorID == user.ID {
+		c.JSON(http.StatusConflict, gin.H{"error": "You cannot delete your own account"})
+		return
+	}
+
+	username := user.Username
+	err := uc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(releasedIdentifiers(user.ID)).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		return ensureUserManager(tx)
+	})
+	if err != nil {
+		respondRoleChangeError(c, err, "Could not delete user")
 		return
 	}
+
+	if err := uc.Tokens.RevokeAll(user.ID); err != nil {
+		log.Printf("Failed to revoke sessions of deleted user: %v", err)
+	}
+	uc.Authz.Invalidate(user.ID)
+
+	recordAudit(uc.DB, c, "user.delete", "user", user.ID, "deleted user %q", username)
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
+// SetUserStatus suspends, deactivates or reactivates an account. Suspended
+// patrons keep signing in but may not borrow; deactivating an account ends
+// its sessions. The account and its history are kept either way.
+func (uc *UserController) SetUserStatus(c *gin.Context) {
+	var input dto.UserStatusRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
+	status := strings.ToUpper(strings.TrimSpace(input.Status))
+	switch status {
+	case models.UserActive:
+		input.Reason, input.Until = "", nil
+	case models.UserSuspended, models.UserDeactivated:
+		if input.Until != nil && !input.Until.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until must be in the future"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of active, suspended or deactivated"})
+		return
+	}
 
+	user, ok := uc.findUser(c)
+	if !ok {
+		return
+	}
+
+	if actorID, _ := c.Get("userID"); actorID == user.ID && status != models.UserActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "You cannot restrict your own account"})
+		return
+	}
+
+	user.Status = status
+	user.StatusReason = strings.TrimSpace(input.Reason)
+	user.StatusUntil = input.Until
+	err := uc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Select("status", "status_reason", "status_until").Updates(&user).Error; err != nil {
+			return err
+		}
+		if status == models.UserDeactivated {
+			return ensureUserManager(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		respondRoleChangeError(c, err, "Could not update account status")
+		return
+	}
+
+	if status == models.UserDeactivated {
+		if err := uc.Tokens.RevokeAll(user.ID); err != nil {
+			log.Printf("Failed to revoke sessions of deactivated user: %v", err)
+		}
+		uc.Authz.Invalidate(user.ID)
+	}
+
+	until := "indefinitely"
+	if user.StatusUntil != nil {
+		until = "until " + user.StatusUntil.Format(time.RFC3339)
+	}
+	recordAudit(uc.DB, c, "user.status", "user", user.ID, "set status of user %q to %s %s (reason: %q)", user.Username, status, until, user.StatusReason)
+	c.JSON(http.StatusOK, dto.NewUserResponse(user))
+}
+
+// ForcePasswordReset logs the user out everywhere and emails a reset link.
+// Password login is refused until the password has been reset.
+func (uc *UserController) ForcePasswordReset(c *gin.Context) {
+	user, ok := uc.findUser(c)
+	if !ok {
+		return
+	}
+
+	var token string
+	err := uc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password_reset_required", true).Error; err != nil {
+			return err
+		}
+		var err error
+		token, err = uc.OneTimeTokens.WithTx(tx).Issue(user.ID, onetime.PurposeResetPassword, resetPasswordTTL, c.ClientIP())
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not force a password reset"})
+		return
+	}
+
+	if err := uc.Tokens.RevokeAll(user.ID); err != nil {
+		log.Printf("Failed to revoke sessions after forced password reset: %v", err)
+	}
+
+	go func() {
+		if err := uc.Email.SendResetPasswordEmail(user.Email, token); err != nil {
+			log.Printf("Failed to send reset password email: %v", err)
+		}
+	}()
+
+	recordAudit(uc.DB, c, "user.force_password_reset", "user", user.ID, "forced a password reset for user %q", user.Username)
+	c.JSON(http.StatusOK, dto.NewUserResponse(user))
+}
+
+// VerifyUserEmail marks the user's email address as verified without the
+// emailed link, e.g. after checking it at the desk
+func (uc *UserController) VerifyUserEmail(c *gin.Context) {
+	user, ok := uc.findUser(c)
+	if !ok {
+		return
+	}
+
+	if err := uc.DB.Model(&user).Update("is_verified", true).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify email"})
+		return
+	}
+
+	recordAudit(uc.DB, c, "user.verify_email", "user", user.ID, "verified email %q of user %q", user.Email, user.Username)
+	c.JSON(http.StatusOK, dto.NewUserResponse(user))
+}
+
+// respondUserWriteError reports a username already in use as a conflict.
+func respondUserWriteError(c *gin.Context, err error, message string) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		c.JSON(http.StatusConflict, gin.H{"error": "A user with this username already exists"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+func (uc *UserController) findUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	if err := uc.DB.Preload("Roles").First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return user, false
+	}
+	return user, true
+}
@@ -0,0 +1,102 @@
+package dto
+
+import (
+	"time"
+
+	"digital-library/backend/internal/models"
+)
+
+// APIKeyRequest creates a personal API key.
+type APIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1,dive,required"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1"`
+}
+
+// APIKeyResponse describes an API key without its secret.
+type APIKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func NewAPIKeyResponse(key models.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
+
+func NewAPIKeyResponses(keys []models.APIKey) []APIKeyResponse {
+	responses := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		responses = append(responses, NewAPIKeyResponse(key))
+	}
+	return responses
+}
+
+// CreatedAPIKeyResponse is returned once, when a key is created, and is the
+// only response that includes the key itself.
+type CreatedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+// SessionResponse describes a login session.
+type SessionResponse struct {
+	ID         uint       `json:"id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Current    bool       `json:"current"`
+}
+
+func NewSessionResponse(session models.Session, currentSessionID uint) SessionResponse {
+	return SessionResponse{
+		ID:         session.ID,
+		UserAgent:  session.UserAgent,
+		IPAddress:  session.IPAddress,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.LastSeenAt,
+		RevokedAt:  session.RevokedAt,
+		Current:    session.ID == currentSessionID,
+	}
+}
+
+func NewSessionResponses(sessions []models.Session, currentSessionID uint) []SessionResponse {
+	responses := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		responses = append(responses, NewSessionResponse(session, currentSessionID))
+	}
+	return responses
+}
+
+// ExternalIdentityResponse describes an account linked at an identity provider.
+type ExternalIdentityResponse struct {
+	Provider string    `json:"provider"`
+	Email    string    `json:"email"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+// AccountExport is everything the library stores about a user.
+type AccountExport struct {
+	ExportedAt         time.Time                  `json:"exported_at"`
+	Profile            UserResponse               `json:"profile"`
+	Loans              []LoanResponse             `json:"loans"`
+	Sessions           []SessionResponse          `json:"sessions"`
+	APIKeys            []APIKeyResponse           `json:"api_keys"`
+	ExternalIdentities []ExternalIdentityResponse `json:"external_identities"`
+}
@@ -0,0 +1,144 @@
+package dto
+
+import (
+	"strings"
+	"time"
+
+	"digital-library/backend/internal/holdings"
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/search"
+)
+
+// BookRequest creates a book or replaces its editable fields. The status
+// is left out: it follows from the book's copies.
+type BookRequest struct {
+	Title           string `json:"title" binding:"required,max=255"`
+	Author          string `json:"author" binding:"required,max=255"`
+	ISBN            string `json:"isbn" binding:"required,max=20"`
+	Description     string `json:"description" binding:"required"`
+	PublicationYear int    `json:"publication_year" binding:"omitempty,min=1,max=9999"`
+	Language        string `json:"language" binding:"omitempty,max=35,bcp47_language_tag"`
+	CategoryID      uint   `json:"category_id" binding:"required"`
+}
+
+func NewBookRequest(book models.Book) BookRequest {
+	return BookRequest{
+		Title:           book.Title,
+		Author:          book.Author,
+		ISBN:            book.ISBN,
+		Description:     book.Description,
+		PublicationYear: book.PublicationYear,
+		Language:        book.Language,
+		CategoryID:      book.CategoryID,
+	}
+}
+
+// Apply copies the request onto the book.
+func (r BookRequest) Apply(book *models.Book) {
+	book.Title = r.Title
+	book.Author = r.Author
+	book.ISBN = r.ISBN
+	book.Description = r.Description
+	book.PublicationYear = r.PublicationYear
+	book.Language = strings.ToLower(r.Language)
+	book.CategoryID = r.CategoryID
+}
+
+// BookColumns are the columns BookRequest.Apply changes.
+var BookColumns = []string{"title", "author", "isbn", "description", "publication_year", "language", "category_id"}
+
+// BookResponse is a book as returned by the API.
+type BookResponse struct {
+	ID              uint              `json:"id"`
+	Title           string            `json:"title"`
+	Author          string            `json:"author"`
+	ISBN            string            `json:"isbn"`
+	Description     string            `json:"description"`
+	PublicationYear int               `json:"publication_year,omitempty"`
+	Language        string            `json:"language,omitempty"`
+	CategoryID      uint              `json:"category_id"`
+	Category        *CategoryResponse `json:"category,omitempty"`
+	Status          string            `json:"status"`
+	// Availability counts the copies; it is included where they were counted
+	Availability *holdings.Availability `json:"availability,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+}
+
+func NewBookResponse(book models.Book) BookResponse {
+	response := BookResponse{
+		ID:              book.ID,
+		Title:           book.Title,
+		Author:          book.Author,
+		ISBN:            book.ISBN,
+		Description:     book.Description,
+		PublicationYear: book.PublicationYear,
+		Language:        book.Language,
+		CategoryID:      book.CategoryID,
+		Status:          book.Status,
+		CreatedAt:       book.CreatedAt,
+		UpdatedAt:       book.UpdatedAt,
+	}
+	if book.Category.ID != 0 {
+		category := NewCategoryResponse(book.Category)
+		response.Category = &category
+	}
+	return response
+}
+
+func NewBookResponses(books []models.Book) []BookResponse {
+	responses := make([]BookResponse, 0, len(books))
+	for _, book := range books {
+		responses = append(responses, NewBookResponse(book))
+	}
+	return responses
+}
+
+// BookSummary identifies a book inside another resource, e.g. a loan.
+type BookSummary struct {
+	ID     uint   `json:"id"`
+	Title  string `json:"title"`
+	Author string `json:"author"`
+	ISBN   string `json:"isbn"`
+}
+
+func NewBookSummary(book models.Book) BookSummary {
+	return BookSummary{ID: book.ID, Title: book.Title, Author: book.Author, ISBN: book.ISBN}
+}
+
+// BookSearchHit is a book matching a search, with its relevance and the
+// matching parts of its text.
+type BookSearchHit struct {
+	BookResponse
+	Score float64 `json:"score"`
+	// Match is "fulltext", or "fuzzy" for books found despite a typo
+	Match string `json:"match"`
+	// Highlights holds HTML-escaped title and description excerpts with the
+	// matches wrapped in <mark>
+	Highlights map[string]string `json:"highlights"`
+}
+
+// BookSearchResponse is a page of search hits with the number of matching
+// books per category, author and status.
+type BookSearchResponse struct {
+	Hits   []BookSearchHit                `json:"hits"`
+	Total  int64                          `json:"total"`
+	Facets map[string][]search.FacetValue `json:"facets"`
+}
+
+func NewBookSearchResponse(results *search.Results) BookSearchResponse {
+	hits := make([]BookSearchHit, 0, len(results.Hits))
+	for _, hit := range results.Hits {
+		hits = append(hits, BookSearchHit{
+			BookResponse: NewBookResponse(hit.Book),
+			Score:        hit.Score,
+			Match:        hit.Match,
+			Highlights:   hit.Highlights,
+		})
+	}
+	facets := results.Facets
+	if facets == nil {
+		facets = map[string][]search.FacetValue{}
+	}
+	return BookSearchResponse{Hits: hits, Total: results.Total, Facets: facets}
+}
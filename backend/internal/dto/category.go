@@ -0,0 +1,55 @@
+package dto
+
+import "digital-library/backend/internal/models"
+
+// CategoryRequest creates a category, at the top of the tree unless a
+// parent is given.
+type CategoryRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+// CategoryRenameRequest renames a category.
+type CategoryRenameRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// CategoryMoveRequest moves a category under another one, or to the top of
+// the tree when parent_id is null.
+type CategoryMoveRequest struct {
+	ParentID *uint `json:"parent_id"`
+}
+
+// CategoryMergeRequest names the category another one is merged into.
+type CategoryMergeRequest struct {
+	TargetID uint `json:"target_id" binding:"required"`
+}
+
+// CategoryResponse is a book category as returned by the API.
+type CategoryResponse struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+func NewCategoryResponse(category models.Category) CategoryResponse {
+	return CategoryResponse{ID: category.ID, Name: category.Name}
+}
+
+// CategoryNodeResponse is a category with its subcategories. BookCount
+// counts the books filed directly under it, TotalBookCount those anywhere
+// in its subtree.
+type CategoryNodeResponse struct {
+	ID             uint                   `json:"id"`
+	Name           string                 `json:"name"`
+	ParentID       *uint                  `json:"parent_id"`
+	BookCount      int64                  `json:"book_count"`
+	TotalBookCount int64                  `json:"total_book_count"`
+	Children       []CategoryNodeResponse `json:"children"`
+}
+
+// CategoryDetailResponse is a category's subtree with the path of
+// categories leading to it from the top of the tree.
+type CategoryDetailResponse struct {
+	CategoryNodeResponse
+	Path []CategoryResponse `json:"path"`
+}
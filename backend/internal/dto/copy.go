@@ -0,0 +1,109 @@
+package dto
+
+import (
+	"time"
+
+	"digital-library/backend/internal/models"
+)
+
+// CopyRequest adds a copy of a book or replaces its editable fields. The
+// status may be set to anything but CHECKED_OUT, which only checkouts set.
+type CopyRequest struct {
+	Barcode       string `json:"barcode" binding:"required,max=32,alphanum"`
+	ShelfLocation string `json:"shelf_location" binding:"max=100"`
+	Condition     string `json:"condition" binding:"omitempty,oneof=NEW GOOD FAIR POOR DAMAGED"`
+	Status        string `json:"status" binding:"omitempty,oneof=AVAILABLE RESERVED IN_REPAIR LOST WITHDRAWN"`
+}
+
+// NewCopyRequest is the request that would leave the copy unchanged. The
+// status of a copy on loan is left out, as clients may not set it.
+func NewCopyRequest(item models.Copy) CopyRequest {
+	request := CopyRequest{
+		Barcode:       item.Barcode,
+		ShelfLocation: item.ShelfLocation,
+		Condition:     item.Condition,
+	}
+	if item.Status != models.CopyCheckedOut {
+		request.Status = item.Status
+	}
+	return request
+}
+
+// Apply copies the request onto the copy. New copies default to a good
+// condition, on the shelf.
+func (r CopyRequest) Apply(item *models.Copy) {
+	item.Barcode = r.Barcode
+	item.ShelfLocation = r.ShelfLocation
+	item.Condition = r.Condition
+	if item.Condition == "" {
+		item.Condition = models.ConditionGood
+	}
+	if r.Status != "" {
+		item.Status = r.Status
+	} else if item.Status == "" {
+		item.Status = models.CopyAvailable
+	}
+}
+
+// CopyColumns are the columns CopyRequest.Apply changes.
+var CopyColumns = []string{"barcode", "shelf_location", "condition", "status"}
+
+// Columns are the CopyColumns the request sets. The status is left out when
+// the request has none, so that a concurrent checkout or return is kept.
+func (r CopyRequest) Columns() []string {
+	if r.Status == "" {
+		return CopyColumns[:len(CopyColumns)-1]
+	}
+	return CopyColumns
+}
+
+// CopyResponse is a copy as returned by the API. Book is included when it
+// was loaded.
+type CopyResponse struct {
+	ID            uint         `json:"id"`
+	BookID        uint         `json:"book_id"`
+	Book          *BookSummary `json:"book,omitempty"`
+	Barcode       string       `json:"barcode"`
+	ShelfLocation string       `json:"shelf_location"`
+	Condition     string       `json:"condition"`
+	Status        string       `json:"status"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+func NewCopyResponse(item models.Copy) CopyResponse {
+	response := CopyResponse{
+		ID:            item.ID,
+		BookID:        item.BookID,
+		Barcode:       item.Barcode,
+		ShelfLocation: item.ShelfLocation,
+		Condition:     item.Condition,
+		Status:        item.Status,
+		CreatedAt:     item.CreatedAt,
+		UpdatedAt:     item.UpdatedAt,
+	}
+	if item.Book.ID != 0 {
+		book := NewBookSummary(item.Book)
+		response.Book = &book
+	}
+	return response
+}
+
+func NewCopyResponses(copies []models.Copy) []CopyResponse {
+	responses := make([]CopyResponse, 0, len(copies))
+	for _, item := range copies {
+		responses = append(responses, NewCopyResponse(item))
+	}
+	return responses
+}
+
+// CopySummary identifies a copy inside another resource, e.g. a loan.
+type CopySummary struct {
+	ID            uint   `json:"id"`
+	Barcode       string `json:"barcode"`
+	ShelfLocation string `json:"shelf_location"`
+}
+
+func NewCopySummary(item models.Copy) CopySummary {
+	return CopySummary{ID: item.ID, Barcode: item.Barcode, ShelfLocation: item.ShelfLocation}
+}
@@ -0,0 +1,83 @@
+// Package dto defines the request and response bodies of the HTTP API.
+// Controllers bind requests into these types rather than into models, so
+// clients can only set the fields listed here, and build responses from
+// them so credentials such as password hashes are never serialized.
+package dto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+// MergePatchContentType is the media type of RFC 7386 JSON merge patches.
+const MergePatchContentType = "application/merge-patch+json"
+
+// ErrInvalidBody is wrapped by the decoding errors returned here.
+var ErrInvalidBody = errors.New("invalid request body")
+
+// DecodeStrict decodes a JSON object into target, rejecting fields target
+// does not declare, and validates it with the binding tags.
+func DecodeStrict(body []byte, target interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBody, err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("%w: trailing data after JSON object", ErrInvalidBody)
+	}
+	return binding.Validator.ValidateStruct(target)
+}
+
+// ApplyMergePatch applies an RFC 7386 merge patch to current, the request
+// DTO filled from the stored record, and decodes the result into target.
+// Members set to null are removed, i.e. reset to their zero value; nested
+// objects are merged. The merged document is validated as a whole.
+func ApplyMergePatch(current interface{}, patch []byte, target interface{}) error {
+	var patchDoc interface{}
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBody, err)
+	}
+	if _, ok := patchDoc.(map[string]interface{}); !ok {
+		return fmt.Errorf("%w: merge patch must be a JSON object", ErrInvalidBody)
+	}
+
+	original, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(original, &doc); err != nil {
+		return err
+	}
+
+	merged, err := json.Marshal(mergePatch(doc, patchDoc))
+	if err != nil {
+		return err
+	}
+	return DecodeStrict(merged, target)
+}
+
+// mergePatch implements the MergePatch algorithm of RFC 7386, section 2.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
@@ -0,0 +1,68 @@
+package dto
+
+import (
+	"time"
+
+	"digital-library/backend/internal/models"
+)
+
+// CheckoutRequest lends a copy to a user. The copy is given by ID or by its
+// scanned barcode; given only a book, any copy on the shelf is lent. The
+// borrower is the caller unless desk staff name another user.
+type CheckoutRequest struct {
+	BookID  uint   `json:"book_id" binding:"required_without_all=CopyID Barcode"`
+	CopyID  uint   `json:"copy_id"`
+	Barcode string `json:"barcode" binding:"omitempty,max=32"`
+	UserID  uint   `json:"user_id"`
+	Days    int    `json:"loan_days" binding:"required,min=1,max=365"` // Loan duration
+}
+
+// LoanResponse is a loan as returned by the API. Book, Copy and User are
+// included when they were loaded.
+type LoanResponse struct {
+	ID           uint         `json:"id"`
+	BookID       uint         `json:"book_id"`
+	Book         *BookSummary `json:"book,omitempty"`
+	CopyID       uint         `json:"copy_id"`
+	Copy         *CopySummary `json:"copy,omitempty"`
+	UserID       uint         `json:"user_id"`
+	User         *UserSummary `json:"user,omitempty"`
+	CheckoutDate time.Time    `json:"checkout_date"`
+	DueDate      time.Time    `json:"due_date"`
+	ReturnDate   *time.Time   `json:"return_date"`
+	Status       string       `json:"status"`
+}
+
+func NewLoanResponse(loan models.Loan) LoanResponse {
+	response := LoanResponse{
+		ID:           loan.ID,
+		BookID:       loan.BookID,
+		CopyID:       loan.CopyID,
+		UserID:       loan.UserID,
+		CheckoutDate: loan.CheckoutDate,
+		DueDate:      loan.DueDate,
+		ReturnDate:   loan.ReturnDate,
+		Status:       loan.Status,
+	}
+	if loan.Book.ID != 0 {
+		book := NewBookSummary(loan.Book)
+		response.Book = &book
+	}
+	if loan.Copy.ID != 0 {
+		summary := NewCopySummary(loan.Copy)
+		response.Copy = &summary
+	}
+	if loan.User.ID != 0 {
+		user := NewUserSummary(loan.User)
+		response.User = &user
+	}
+	return response
+}
+
+func NewLoanResponses(loans []models.Loan) []LoanResponse {
+	responses := make([]LoanResponse, 0, len(loans))
+	for _, loan := range loans {
+		responses = append(responses, NewLoanResponse(loan))
+	}
+	return responses
+}
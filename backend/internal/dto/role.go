@@ -0,0 +1,97 @@
+package dto
+
+import (
+	"time"
+
+	"digital-library/backend/internal/models"
+)
+
+// RoleRequest creates a role, optionally with permissions.
+type RoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=50"`
+	Permissions []string `json:"permissions" binding:"dive,required"`
+}
+
+// RoleRenameRequest renames a role.
+type RoleRenameRequest struct {
+	Name string `json:"name" binding:"required,max=50"`
+}
+
+// PermissionsRequest lists permissions to grant.
+type PermissionsRequest struct {
+	Permissions []string `json:"permissions" binding:"required,min=1,dive,required"`
+}
+
+// PermissionRequest creates a permission.
+type PermissionRequest struct {
+	Name string `json:"name" binding:"required,max=50"`
+}
+
+// PermissionResponse is a permission as returned by the API.
+type PermissionResponse struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+func NewPermissionResponse(permission models.Permission) PermissionResponse {
+	return PermissionResponse{ID: permission.ID, Name: permission.Name}
+}
+
+func NewPermissionResponses(permissions []models.Permission) []PermissionResponse {
+	responses := make([]PermissionResponse, 0, len(permissions))
+	for _, permission := range permissions {
+		responses = append(responses, NewPermissionResponse(permission))
+	}
+	return responses
+}
+
+// RoleResponse is a role with the names of its permissions.
+type RoleResponse struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func NewRoleResponse(role models.Role) RoleResponse {
+	permissions := make([]string, 0, len(role.Permissions))
+	for _, permission := range role.Permissions {
+		permissions = append(permissions, permission.Name)
+	}
+	return RoleResponse{ID: role.ID, Name: role.Name, Permissions: permissions, CreatedAt: role.CreatedAt}
+}
+
+func NewRoleResponses(roles []models.Role) []RoleResponse {
+	responses := make([]RoleResponse, 0, len(roles))
+	for _, role := range roles {
+		responses = append(responses, NewRoleResponse(role))
+	}
+	return responses
+}
+
+// AuditLogResponse is an audit entry as returned by the API.
+type AuditLogResponse struct {
+	ID         uint      `json:"id"`
+	ActorID    uint      `json:"actor_id"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"`
+	TargetID   uint      `json:"target_id"`
+	Details    string    `json:"details"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func NewAuditLogResponses(logs []models.AuditLog) []AuditLogResponse {
+	responses := make([]AuditLogResponse, 0, len(logs))
+	for _, entry := range logs {
+		responses = append(responses, AuditLogResponse{
+			ID:         entry.ID,
+			ActorID:    entry.ActorID,
+			Action:     entry.Action,
+			TargetType: entry.TargetType,
+			TargetID:   entry.TargetID,
+			Details:    entry.Details,
+			CreatedAt:  entry.CreatedAt,
+		})
+	}
+	return responses
+}
@@ -0,0 +1,158 @@
+package dto
+
+import (
+	"time"
+
+	"digital-library/backend/internal/models"
+)
+
+// UserResponse is a user as returned by the API.
+type UserResponse struct {
+	ID                    uint                   `json:"id"`
+	Username              string                 `json:"username"`
+	Email                 string                 `json:"email"`
+	CardNumber            string                 `json:"card_number,omitempty"`
+	DisplayName           string                 `json:"display_name"`
+	Phone                 string                 `json:"phone"`
+	Preferences           map[string]interface{} `json:"preferences"`
+	ProfilePhoto          string                 `json:"profile_photo"`
+	IsVerified            bool                   `json:"is_verified"`
+	Status                string                 `json:"status"`
+	StatusReason          string                 `json:"status_reason,omitempty"`
+	StatusUntil           *time.Time             `json:"status_until,omitempty"`
+	PasswordResetRequired bool                   `json:"password_reset_required"`
+	TwoFactorEnabled      bool                   `json:"two_factor_enabled"`
+	Roles                 []string               `json:"roles"`
+	CreatedAt             time.Time              `json:"created_at"`
+	UpdatedAt             time.Time              `json:"updated_at"`
+}
+
+func NewUserResponse(user models.User) UserResponse {
+	roles := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		roles = append(roles, role.Name)
+	}
+	status := NewAccountStatus(user)
+	var cardNumber string
+	if user.CardNumber != nil {
+		cardNumber = *user.CardNumber
+	}
+	return UserResponse{
+		ID:                    user.ID,
+		Username:              user.Username,
+		Email:                 user.Email,
+		CardNumber:            cardNumber,
+		DisplayName:           user.DisplayName,
+		Phone:                 user.Phone,
+		Preferences:           user.Preferences,
+		ProfilePhoto:          user.ProfilePhoto,
+		IsVerified:            user.IsVerified,
+		Status:                user.CurrentStatus(),
+		StatusReason:          status.Reason,
+		StatusUntil:           status.Until,
+		PasswordResetRequired: user.PasswordResetRequired,
+		TwoFactorEnabled:      user.TOTPEnabled,
+		Roles:                 roles,
+		CreatedAt:             user.CreatedAt,
+		UpdatedAt:             user.UpdatedAt,
+	}
+}
+
+func NewUserResponses(users []models.User) []UserResponse {
+	responses := make([]UserResponse, 0, len(users))
+	for _, user := range users {
+		responses = append(responses, NewUserResponse(user))
+	}
+	return responses
+}
+
+// AccountStatus explains why an account is restricted and until when.
+type AccountStatus struct {
+	Status string     `json:"status"`
+	Reason string     `json:"reason,omitempty"`
+	Until  *time.Time `json:"until,omitempty"`
+}
+
+// NewAccountStatus describes the status in effect now; the reason and end
+// date of a lapsed restriction are left out.
+func NewAccountStatus(user models.User) AccountStatus {
+	status := user.CurrentStatus()
+	if status == models.UserActive {
+		return AccountStatus{Status: status}
+	}
+	return AccountStatus{Status: status, Reason: user.StatusReason, Until: user.StatusUntil}
+}
+
+// UserStatusRequest sets an account's status. Reason and until are ignored
+// when reactivating.
+type UserStatusRequest struct {
+	Status string     `json:"status" binding:"required"`
+	Reason string     `json:"reason" binding:"max=500"`
+	Until  *time.Time `json:"until"`
+}
+
+// UserSummary identifies a user inside another resource, e.g. a loan.
+type UserSummary struct {
+	ID          uint   `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+func NewUserSummary(user models.User) UserSummary {
+	return UserSummary{ID: user.ID, Username: user.Username, DisplayName: user.DisplayName}
+}
+
+// ProfileUpdateRequest holds the fields users may change on their own profile.
+type ProfileUpdateRequest struct {
+	DisplayName string                 `json:"display_name" binding:"max=100"`
+	Phone       string                 `json:"phone" binding:"omitempty,e164"`
+	Preferences map[string]interface{} `json:"preferences"`
+}
+
+func NewProfileUpdateRequest(user models.User) ProfileUpdateRequest {
+	return ProfileUpdateRequest{
+		DisplayName: user.DisplayName,
+		Phone:       user.Phone,
+		Preferences: user.Preferences,
+	}
+}
+
+// Apply copies the request onto the user.
+func (r ProfileUpdateRequest) Apply(user *models.User) {
+	user.DisplayName = r.DisplayName
+	user.Phone = r.Phone
+	user.Preferences = r.Preferences
+}
+
+// ProfileColumns are the columns ProfileUpdateRequest.Apply changes.
+var ProfileColumns = []string{"display_name", "phone", "preferences"}
+
+// UserUpdateRequest holds the fields an administrator may change on any
+// user. Email changes go through the confirmation flow, and credentials
+// and roles have endpoints of their own.
+type UserUpdateRequest struct {
+	Username    string                 `json:"username" binding:"required,max=50"`
+	DisplayName string                 `json:"display_name" binding:"max=100"`
+	Phone       string                 `json:"phone" binding:"omitempty,e164"`
+	Preferences map[string]interface{} `json:"preferences"`
+}
+
+func NewUserUpdateRequest(user models.User) UserUpdateRequest {
+	return UserUpdateRequest{
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Phone:       user.Phone,
+		Preferences: user.Preferences,
+	}
+}
+
+// Apply copies the request onto the user.
+func (r UserUpdateRequest) Apply(user *models.User) {
+	user.Username = r.Username
+	user.DisplayName = r.DisplayName
+	user.Phone = r.Phone
+	user.Preferences = r.Preferences
+}
+
+// UserColumns are the columns UserUpdateRequest.Apply changes.
+var UserColumns = []string{"username", "display_name", "phone", "preferences"}
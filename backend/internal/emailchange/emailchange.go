@@ -0,0 +1,144 @@
+package emailchange
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/utils"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// uniqueViolation is the Postgres error code for a unique index conflict.
+const uniqueViolation = "23505"
+
+var (
+	// ErrInvalidToken is returned for unknown, expired or already used confirmation links.
+	ErrInvalidToken = errors.New("invalid or expired confirmation link")
+	// ErrEmailTaken is returned when the new address already belongs to an account.
+	ErrEmailTaken = errors.New("email already belongs to another account")
+	// ErrSameEmail is returned when the new address is the current one.
+	ErrSameEmail = errors.New("new email is the same as the current one")
+)
+
+// Service runs the two-step email change: a request stores the new address,
+// and it replaces the old one only once the link sent there is followed.
+type Service struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+func NewService(db *gorm.DB, ttl time.Duration) *Service {
+	return &Service{db: db, ttl: ttl}
+}
+
+// Request records a pending change for the user and returns the token to
+// send to the new address. It replaces any earlier pending change.
+func (s *Service) Request(user models.User, newEmail string) (string, error) {
+	if strings.EqualFold(newEmail, user.Email) {
+		return "", ErrSameEmail
+	}
+	taken, err := emailTaken(s.db, newEmail)
+	if err != nil {
+		return "", err
+	}
+	if taken {
+		return "", ErrEmailTaken
+	}
+
+	token, err := utils.GenerateVerificationToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.EmailChange{}).
+			Where("user_id = ? AND confirmed_at IS NULL AND expires_at > ?", user.ID, now).
+			Update("expires_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.EmailChange{
+			UserID:    user.ID,
+			NewEmail:  newEmail,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: now.Add(s.ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Confirm applies the pending change the token belongs to and returns the
+// updated user together with the address it replaced.
+func (s *Service) Confirm(token string) (*models.User, string, error) {
+	var user models.User
+	var oldEmail string
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var change models.EmailChange
+		err := tx.Where("token_hash = ? AND confirmed_at IS NULL AND expires_at > ?", utils.HashToken(token), time.Now()).
+			First(&change).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.First(&user, change.UserID).Error; err != nil {
+			return err
+		}
+
+		// The address may have been claimed since the change was requested
+		taken, err := emailTaken(tx, change.NewEmail)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrEmailTaken
+		}
+
+		now := time.Now()
+		result := tx.Model(&models.EmailChange{}).
+			Where("id = ? AND confirmed_at IS NULL", change.ID).
+			Update("confirmed_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidToken
+		}
+
+		oldEmail = user.Email
+		user.Email = change.NewEmail
+		user.IsVerified = true
+		// The unique index on users.email still guards against a concurrent
+		// registration with the same address
+		err = tx.Model(&user).Updates(map[string]interface{}{
+			"email":       change.NewEmail,
+			"is_verified": true,
+		}).Error
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrEmailTaken
+		}
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &user, oldEmail, nil
+}
+
+// emailTaken checks every account, including soft-deleted ones, since the
+// unique index covers those rows too.
+func emailTaken(db *gorm.DB, email string) (bool, error) {
+	var count int64
+	err := db.Unscoped().Model(&models.User{}).Where("LOWER(email) = LOWER(?)", email).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,95 @@
+// Package holdings tracks the physical copies the library owns of each book
+// and derives the book's availability from them.
+package holdings
+
+import (
+	"digital-library/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Availability counts a book's copies by what they can be used for.
+type Availability struct {
+	Copies     int64 `json:"copies"`
+	Available  int64 `json:"available"`
+	CheckedOut int64 `json:"checked_out"`
+	Reserved   int64 `json:"reserved"`
+	// Unavailable copies are in repair or lost; withdrawn copies are not
+	// counted at all
+	Unavailable int64 `json:"unavailable"`
+}
+
+// add counts n copies with the given status.
+func (a *Availability) add(status string, n int64) {
+	switch status {
+	case models.CopyWithdrawn:
+		return
+	case models.CopyAvailable:
+		a.Available += n
+	case models.CopyCheckedOut:
+		a.CheckedOut += n
+	case models.CopyReserved:
+		a.Reserved += n
+	default:
+		a.Unavailable += n
+	}
+	a.Copies += n
+}
+
+// Status is the book status summarising the copies.
+func (a Availability) Status() string {
+	switch {
+	case a.Available > 0:
+		return models.BookAvailable
+	case a.CheckedOut > 0:
+		return models.BookCheckedOut
+	case a.Reserved > 0:
+		return models.BookReserved
+	}
+	return models.BookUnavailable
+}
+
+// Load counts the copies of each of the books. Books without copies get a
+// zero Availability.
+func Load(db *gorm.DB, bookIDs []uint) (map[uint]Availability, error) {
+	availability := make(map[uint]Availability, len(bookIDs))
+	if len(bookIDs) == 0 {
+		return availability, nil
+	}
+
+	var counts []struct {
+		BookID uint
+		Status string
+		Count  int64
+	}
+	err := db.Model(&models.Copy{}).
+		Select("book_id, status, COUNT(*) AS count").
+		Where("book_id IN ?", bookIDs).
+		Group("book_id, status").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range bookIDs {
+		availability[id] = Availability{}
+	}
+	for _, count := range counts {
+		a := availability[count.BookID]
+		a.add(count.Status, count.Count)
+		availability[count.BookID] = a
+	}
+	return availability, nil
+}
+
+// Refresh sets the book's status from its copies. Call it in the same
+// transaction as any change to the copies.
+func Refresh(tx *gorm.DB, bookID uint) error {
+	availability, err := Load(tx, []uint{bookID})
+	if err != nil {
+		return err
+	}
+	// Update through a model carrying the ID so that hooks keyed on the
+	// book, such as the search index, see which book changed
+	book := models.Book{Model: gorm.Model{ID: bookID}}
+	return tx.Model(&book).Update("status", availability[bookID].Status()).Error
+}
@@ -0,0 +1,85 @@
+package librarycard
+
+import (
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+)
+
+// Barcode image formats
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+// ErrUnsupportedFormat is returned for an image format other than PNG or SVG.
+var ErrUnsupportedFormat = errors.New("unsupported barcode format")
+
+// quietZone is the blank margin, in bar widths, scanners need on either side.
+const quietZone = 10
+
+// ContentType returns the MIME type of a barcode image format.
+func ContentType(format string) string {
+	if format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// RenderBarcode writes the card number as a Code 128 barcode, width by height
+// pixels, for printing on cards.
+func RenderBarcode(w io.Writer, number, format string, width, height int) error {
+	code, err := code128.Encode(number)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatPNG:
+		scaled, err := barcode.Scale(code, width, height)
+		if err != nil {
+			return err
+		}
+		return png.Encode(w, scaled)
+	case FormatSVG:
+		return writeSVG(w, code, width, height)
+	default:
+		return ErrUnsupportedFormat
+	}
+}
+
+// writeSVG draws each run of dark modules as one rectangle, in a viewBox
+// measured in modules so the image scales without blurring the bars.
+func writeSVG(w io.Writer, code barcode.Barcode, width, height int) error {
+	modules := code.Bounds().Dx()
+	total := modules + 2*quietZone
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" preserveAspectRatio="none" shape-rendering="crispEdges">`, width, height, total, height)
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="#fff"/>`, total, height)
+	for x := 0; x < modules; {
+		if !dark(code, x) {
+			x++
+			continue
+		}
+		start := x
+		for x < modules && dark(code, x) {
+			x++
+		}
+		fmt.Fprintf(&svg, `<rect x="%d" width="%d" height="%d"/>`, quietZone+start, x-start, height)
+	}
+	svg.WriteString(`</svg>`)
+
+	_, err := io.WriteString(w, svg.String())
+	return err
+}
+
+func dark(code barcode.Barcode, x int) bool {
+	r, _, _, _ := code.At(x, 0).RGBA()
+	return r == 0
+}
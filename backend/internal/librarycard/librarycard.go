@@ -0,0 +1,168 @@
+package librarycard
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+
+	"digital-library/backend/internal/models"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidNumber is returned for input that is not a card number at
+	// all, e.g. a misread barcode whose check digit does not match.
+	ErrInvalidNumber = errors.New("invalid library card number")
+	// ErrCardNotFound is returned when no account has the card number.
+	ErrCardNotFound = errors.New("library card not found")
+	// ErrNumbersExhausted is returned when every generated number collided
+	// with an existing card; the format leaves too few random digits.
+	ErrNumbersExhausted = errors.New("could not generate an unused card number")
+)
+
+// maxAttempts bounds how often a colliding number is regenerated.
+const maxAttempts = 5
+
+type Config struct {
+	// Prefix starts every card number, e.g. a code for the library system.
+	// Digits only.
+	Prefix string
+	// Length is the total number of digits, including the prefix and the
+	// trailing Luhn check digit.
+	Length int
+}
+
+// Service issues library card numbers and finds patrons by them.
+type Service struct {
+	db     *gorm.DB
+	config Config
+}
+
+func NewService(db *gorm.DB, cfg Config) *Service {
+	if cfg.Length == 0 {
+		cfg.Length = 14
+	}
+	return &Service{db: db, config: cfg}
+}
+
+// Generate returns a random card number in the configured format. It is not
+// checked against the numbers already issued; Assign does that.
+func (s *Service) Generate() (string, error) {
+	random := s.config.Length - len(s.config.Prefix) - 1
+	if random < 1 {
+		return "", errors.New("card number length leaves no room for random digits")
+	}
+
+	digits := make([]byte, 0, random)
+	buf := make([]byte, 1)
+	for len(digits) < random {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		// Rejecting 250-255 keeps every digit equally likely
+		if buf[0] < 250 {
+			digits = append(digits, '0'+buf[0]%10)
+		}
+	}
+
+	body := s.config.Prefix + string(digits)
+	return body + string(checkDigit(body)), nil
+}
+
+// Assign gives the user a new card number, replacing any earlier one. Run it
+// in the transaction that creates the user so no account is left without one.
+func (s *Service) Assign(tx *gorm.DB, userID uint) (string, error) {
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		number, err := s.Generate()
+		if err != nil {
+			return "", err
+		}
+
+		// The savepoint keeps a collision from aborting the caller's transaction
+		err = tx.Transaction(func(inner *gorm.DB) error {
+			return inner.Model(&models.User{}).Where("id = ?", userID).Update("card_number", number).Error
+		})
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return number, nil
+	}
+	return "", ErrNumbersExhausted
+}
+
+// Backfill assigns card numbers to accounts created before cards existed and
+// returns how many it assigned.
+func (s *Service) Backfill() (int, error) {
+	var ids []uint
+	if err := s.db.Model(&models.User{}).Where("card_number IS NULL").Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if _, err := s.Assign(s.db, id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// Lookup finds the account a scanned or typed card number belongs to.
+func (s *Service) Lookup(number string) (*models.User, error) {
+	number = Normalize(number)
+	if !Valid(number) {
+		return nil, ErrInvalidNumber
+	}
+
+	var user models.User
+	if err := s.db.Preload("Roles").Where("card_number = ?", number).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCardNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Normalize strips the spaces and dashes card numbers are often printed or
+// typed with.
+func Normalize(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(number))
+}
+
+// Valid reports whether number consists of digits ending in a correct Luhn
+// check digit. The prefix and length are not checked, so cards issued under
+// an earlier format keep working.
+func Valid(number string) bool {
+	if len(number) < 2 {
+		return false
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	body, check := number[:len(number)-1], number[len(number)-1]
+	return checkDigit(body) == check
+}
+
+// checkDigit computes the Luhn check digit for a string of digits.
+func checkDigit(body string) byte {
+	sum := 0
+	double := true
+	for i := len(body) - 1; i >= 0; i-- {
+		d := int(body[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return byte('0' + (10-sum%10)%10)
+}
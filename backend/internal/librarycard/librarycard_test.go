@@ -0,0 +1,110 @@
+package librarycard
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckDigit(t *testing.T) {
+	tests := []struct {
+		body string
+		want byte
+	}{
+		{"7992739871", '3'},
+		{"453914880343646", '7'},
+		{"123456781234567", '0'},
+		{"0", '0'},
+		{"1", '8'},
+		{"", '0'},
+	}
+	for _, tt := range tests {
+		if got := checkDigit(tt.body); got != tt.want {
+			t.Errorf("checkDigit(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"79927398713", true},
+		{"4539148803436467", true},
+		{"1234567812345670", true},
+		{"18", true},
+		{"79927398710", false},
+		{"79927398714", false},
+		{"7992739871a", false},
+		{"7992 7398 713", false}, // Lookup normalizes first
+		{"0", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.number); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+}
+
+// The Luhn check digit catches every single mistyped digit.
+func TestValidRejectsSingleDigitErrors(t *testing.T) {
+	const number = "79927398713"
+	for i := range number {
+		for d := byte('0'); d <= '9'; d++ {
+			if d == number[i] {
+				continue
+			}
+			typo := number[:i] + string(d) + number[i+1:]
+			if Valid(typo) {
+				t.Errorf("Valid(%q) = true for a typo of %q at position %d", typo, number, i)
+			}
+		}
+	}
+}
+
+// The Luhn check digit catches swapped neighbours, except 09 and 90.
+func TestValidRejectsTranspositions(t *testing.T) {
+	for _, body := range []string{"7992739871", "453914880343646", "212345678901"} {
+		number := body + string(checkDigit(body))
+		for i := 0; i+1 < len(number); i++ {
+			a, b := number[i], number[i+1]
+			if a == b || (a == '0' && b == '9') || (a == '9' && b == '0') {
+				continue
+			}
+			swapped := number[:i] + string(b) + string(a) + number[i+2:]
+			if Valid(swapped) {
+				t.Errorf("Valid(%q) = true with positions %d and %d of %q swapped", swapped, i, i+1, number)
+			}
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got := Normalize(" 7992-7398 713 "); got != "79927398713" || !Valid(got) {
+		t.Errorf("Normalize = %q, want the valid 79927398713", got)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	s := NewService(nil, Config{Prefix: "29", Length: 14})
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		number, err := s.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(number) != 14 || !strings.HasPrefix(number, "29") || !Valid(number) {
+			t.Fatalf("Generate() = %q, want 14 valid digits starting with 29", number)
+		}
+		seen[number] = true
+	}
+	// 11 random digits: a repeat among a thousand is vanishingly unlikely
+	if len(seen) != 1000 {
+		t.Errorf("Generate() repeated numbers: %d distinct of 1000", len(seen))
+	}
+
+	if _, err := NewService(nil, Config{Prefix: "29", Length: 3}).Generate(); err == nil {
+		t.Error("Generate() with no room for random digits succeeded")
+	}
+}
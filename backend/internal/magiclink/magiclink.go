@@ -0,0 +1,64 @@
+package magiclink
+
+import (
+	"errors"
+	"time"
+
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/onetime"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidLink is returned for unknown, expired or already used links.
+var ErrInvalidLink = errors.New("invalid or expired login link")
+
+// Service issues and redeems single-use passwordless login links.
+type Service struct {
+	db     *gorm.DB
+	tokens *onetime.Service
+	ttl    time.Duration
+}
+
+func NewService(db *gorm.DB, tokenStore *onetime.Service, ttl time.Duration) *Service {
+	return &Service{db: db, tokens: tokenStore, ttl: ttl}
+}
+
+// TTL is how long a link stays valid after it is sent.
+func (s *Service) TTL() time.Duration {
+	return s.ttl
+}
+
+// Create stores a new link for the user and returns the token to email.
+// Earlier unused links of the user stop working.
+func (s *Service) Create(userID uint, ipAddress string) (string, error) {
+	return s.tokens.Issue(userID, onetime.PurposeMagicLink, s.ttl, ipAddress)
+}
+
+// Consume redeems a link and returns its user with roles loaded.
+func (s *Service) Consume(token string) (*models.User, error) {
+	var user models.User
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		userID, err := s.tokens.WithTx(tx).Consume(onetime.PurposeMagicLink, token)
+		if err != nil {
+			if errors.Is(err, onetime.ErrInvalidToken) {
+				return ErrInvalidLink
+			}
+			return err
+		}
+
+		if err := tx.Preload("Roles").First(&user, userID).Error; err != nil {
+			return err
+		}
+		// Following the emailed link proves the address, like verification does
+		if !user.IsVerified {
+			user.IsVerified = true
+			return tx.Model(&user).Update("is_verified", true).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
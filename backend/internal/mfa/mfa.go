@@ -0,0 +1,346 @@
+package mfa
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"image/png"
+	"strings"
+	"time"
+
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/utils"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrNotEnrolled      = errors.New("two-factor authentication enrollment has not been started")
+	ErrNotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrInvalidCode      = errors.New("invalid authentication code")
+	ErrInvalidChallenge = errors.New("invalid or expired login challenge")
+)
+
+const (
+	period               = 30 // seconds per TOTP time step
+	skew                 = 1  // steps accepted either side of the current one
+	recoveryCodeCount    = 10
+	challengeTTL         = 5 * time.Minute
+	maxChallengeAttempts = 5
+)
+
+type Config struct {
+	Issuer string
+	// RequiredPermissions lists permissions whose holders must use 2FA.
+	// Such users can only reach the enrollment endpoints until they enroll.
+	RequiredPermissions []string
+}
+
+// Enrollment is returned when a user starts setting up an authenticator app.
+type Enrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRCodePNG  string `json:"qr_code_png"` // base64-encoded PNG of the otpauth URI
+}
+
+// Service implements TOTP enrollment and verification, recovery codes and
+// the login challenge step.
+type Service struct {
+	db     *gorm.DB
+	config Config
+}
+
+func NewService(db *gorm.DB, cfg Config) *Service {
+	return &Service{db: db, config: cfg}
+}
+
+// Required reports whether the policy demands 2FA from a user holding these permissions.
+func (s *Service) Required(permissions authz.PermissionSet) bool {
+	return permissions.HasAny(s.config.RequiredPermissions...)
+}
+
+// Enabled reports whether the user has completed 2FA enrollment.
+func (s *Service) Enabled(userID uint) (bool, error) {
+	var user models.User
+	if err := s.db.Select("totp_enabled").First(&user, userID).Error; err != nil {
+		return false, err
+	}
+	return user.TOTPEnabled, nil
+}
+
+// Enroll generates a new secret for the user. It only takes effect once
+// confirmed with a valid code, so a half-finished enrollment locks nobody out.
+func (s *Service) Enroll(user *models.User) (*Enrollment, error) {
+	if user.TOTPEnabled {
+		return nil, ErrAlreadyEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.config.Issuer,
+		AccountName: user.Email,
+		Period:      period,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPSecret = key.Secret()
+	user.TOTPLastStep = 0
+	if err := s.db.Model(user).Select("totp_secret", "totp_last_step").Updates(user).Error; err != nil {
+		return nil, err
+	}
+
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return &Enrollment{
+		Secret:     key.Secret(),
+		OTPAuthURI: key.URL(),
+		QRCodePNG:  base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// Confirm enables 2FA after checking a code from the newly enrolled
+// authenticator and returns a fresh set of recovery codes.
+func (s *Service) Confirm(user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrNotEnrolled
+	}
+	if err := s.verifyCode(user, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// Disable turns 2FA off and discards the secret and recovery codes.
+func (s *Service) Disable(user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrNotEnabled
+	}
+	if err := s.Verify(user, code); err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes invalidates the user's recovery codes and issues new ones.
+func (s *Service) RegenerateRecoveryCodes(user *models.User, code string) ([]string, error) {
+	if !user.TOTPEnabled {
+		return nil, ErrNotEnabled
+	}
+	if err := s.verifyCode(user, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// Verify accepts either a current TOTP code or an unused recovery code.
+func (s *Service) Verify(user *models.User, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == 6 {
+		return s.verifyCode(user, code)
+	}
+	return s.useRecoveryCode(user.ID, code)
+}
+
+// verifyCode checks a TOTP code against the user's secret. Each time step is
+// accepted at most once so an observed code cannot be replayed.
+func (s *Service) verifyCode(user *models.User, code string) error {
+	code = strings.TrimSpace(code)
+	now := time.Now()
+	current := now.Unix() / period
+
+	for offset := int64(-skew); offset <= skew; offset++ {
+		step := current + offset
+		if step <= user.TOTPLastStep {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(user.TOTPSecret, time.Unix(step*period, 0), totp.ValidateOpts{
+			Period:    period,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return err
+		}
+		if expected != code {
+			continue
+		}
+
+		// Only advance the step if no concurrent request already used it.
+		result := s.db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidCode
+		}
+		user.TOTPLastStep = step
+		return nil
+	}
+	return ErrInvalidCode
+}
+
+func (s *Service) useRecoveryCode(userID uint, code string) error {
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return ErrInvalidCode
+	}
+
+	result := s.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(normalized)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// CreateChallenge starts the second login step and returns its token.
+func (s *Service) CreateChallenge(userID uint) (string, error) {
+	token, err := utils.GenerateVerificationToken()
+	if err != nil {
+		return "", err
+	}
+
+	challenge := models.MFAChallenge{
+		UserID:    userID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(challengeTTL),
+	}
+	if err := s.db.Create(&challenge).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CompleteChallenge verifies the code for a pending login challenge and
+// returns the user it was issued for. Every code tried counts as an attempt;
+// a challenge is consumed on success and refused after too many attempts.
+func (s *Service) CompleteChallenge(token, code string) (*models.User, error) {
+	var challenge models.MFAChallenge
+	err := s.db.Where("token_hash = ? AND consumed_at IS NULL AND expires_at > ? AND attempts < ?",
+		utils.HashToken(token), time.Now(), maxChallengeAttempts).First(&challenge).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, err
+	}
+
+	var user models.User
+	if err := s.db.Preload("Roles").First(&user, challenge.UserID).Error; err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	// Claim an attempt before checking the code, so that concurrent guesses
+	// cannot exceed the limit between reading and counting
+	claimed := s.db.Model(&models.MFAChallenge{}).
+		Where("id = ? AND consumed_at IS NULL AND attempts < ?", challenge.ID, maxChallengeAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if claimed.Error != nil {
+		return nil, claimed.Error
+	}
+	if claimed.RowsAffected != 1 {
+		return nil, ErrInvalidChallenge
+	}
+
+	if err := s.Verify(&user, code); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := s.db.Model(&models.MFAChallenge{}).
+		Where("id = ? AND consumed_at IS NULL", challenge.ID).
+		Update("consumed_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidChallenge
+	}
+	return &user, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(normalizeRecoveryCode(code))})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code such as "K3PQ-7XWM-2HDA-9RTE".
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	raw := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+	return raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -1,55 +1,226 @@
 package middleware
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strings"
+	"digital-library/backend/internal/apikeys"
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/dto"
+	"digital-library/backend/internal/mfa"
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/tokens"
 	"digital-library/backend/internal/utils"
 	"github.com/gin-gonic/gin"
 	 jwt "github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
-func JWTAuth() gin.HandlerFunc {
+
+// Authenticator holds the dependencies JWTAuth needs to identify the caller
+// and resolve what they are allowed to do.
+type Authenticator struct {
+	DB      *gorm.DB
+	Authz   *authz.Service
+	Tokens  *tokens.Service
+	MFA     *mfa.Service
+	APIKeys *apikeys.Service
+}
+
+func NewAuthenticator(db *gorm.DB, authzService *authz.Service, tokenService *tokens.Service, mfaService *mfa.Service, apiKeyService *apikeys.Service) *Authenticator {
+	return &Authenticator{DB: db, Authz: authzService, Tokens: tokenService, MFA: mfaService, APIKeys: apiKeyService}
+}
+
+// twoFactorSetupPath is the route prefix a user who must enroll in 2FA can
+// still reach before doing so.
+const twoFactorSetupPath = "/auth/2fa/"
+
+// APIKeyHeader carries a personal API key. Keys are also accepted as a
+// Bearer token in the Authorization header.
+const APIKeyHeader = "X-API-Key"
+
+func (a *Authenticator) JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context){
+		if key := c.GetHeader(APIKeyHeader); key != "" {
+			a.apiKeyAuth(c, key)
+			return
+		}
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			return
 		}
-		tokenString:= strings.Split(authHeader, "Bearer ")[1]
-
-		if tokenString ==""{
+		tokenString, ok := strings.CutPrefix(authHeader, "Bearer ")
+		if !ok || tokenString == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
 			return
 		}
+		if apikeys.IsKey(tokenString) {
+			a.apiKeyAuth(c, tokenString)
+			return
+		}
 		token, err := utils.ParseJWT(tokenString)
 		if err != nil || !token.Valid {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			return
 		}
-		claims:=token.Claims.(jwt.MapClaims)
-		c.Set("userID", claims["user_id"])
+		claims := token.Claims.(jwt.MapClaims)
+		userID, ok := claims["user_id"].(float64)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+
+		// Reject access tokens whose session was revoked by logout, refresh
+		// token reuse detection or an administrator.
+		sessionID, _ := claims["sid"].(float64)
+		active, err := a.Tokens.SessionActive(uint(sessionID))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+			return
+		}
+		if !active {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			return
+		}
+		if !a.accountActive(c, uint(userID)) {
+			return
+		}
+		if err := a.Tokens.Touch(uint(sessionID)); err != nil {
+			log.Printf("Failed to update session activity: %v", err)
+		}
+
+		// Permissions are resolved from the user's roles on every request so
+		// that role changes apply without waiting for the token to expire.
+		permissions, err := a.Authz.Permissions(uint(userID))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+			return
+		}
+
+		// Users the policy requires 2FA from may only finish enrolling until they have
+		if a.MFA.Required(permissions) && !strings.HasPrefix(c.FullPath(), twoFactorSetupPath) {
+			enabled, err := a.MFA.Enabled(uint(userID))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check two-factor status"})
+				return
+			}
+			if !enabled {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication must be enabled for this account"})
+				return
+			}
+		}
+
+		c.Set("userID", uint(userID))
+		c.Set("sessionID", uint(sessionID))
 		c.Set("roles", claims["roles"])
+		c.Set("permissions", permissions)
 		c.Next()
+	}
+}
 
+// apiKeyAuth authenticates a request made with a personal API key. The
+// request gets only the key's scopes that the owner still holds, and no
+// session; the owner already passed any 2FA requirement to create the key.
+func (a *Authenticator) apiKeyAuth(c *gin.Context, plaintext string) {
+	key, permissions, err := a.APIKeys.Authenticate(plaintext)
+	if err != nil {
+		if errors.Is(err, apikeys.ErrInvalidKey) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate API key"})
+		return
+	}
 
+	if !a.accountActive(c, key.UserID) {
+		return
+	}
 
-	
+	c.Set("userID", key.UserID)
+	c.Set("apiKeyID", key.ID)
+	c.Set("permissions", permissions)
+	c.Next()
+}
 
+// accountActive aborts the request unless the user still exists and may
+// sign in. Deactivating an account revokes its sessions, but API keys and
+// access tokens already handed out would otherwise keep working. Suspended
+// accounts get through; the actions they may not take check for themselves.
+func (a *Authenticator) accountActive(c *gin.Context, userID uint) bool {
+	var user models.User
+	err := a.DB.Select("id", "status", "status_reason", "status_until").First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return false
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check account status"})
+		return false
+	}
+	if !user.CanSignIn() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":          "Account is deactivated",
+			"account_status": dto.NewAccountStatus(user),
+		})
+		return false
 	}
+	return true
 }
 
+// RequireSession rejects requests authenticated with an API key, for
+// endpoints that manage credentials and must not be reachable by a script.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, viaKey := c.Get("apiKeyID"); viaKey {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This endpoint cannot be used with an API key"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func permissionsFrom(c *gin.Context) (authz.PermissionSet, bool) {
+	value, exists := c.Get("permissions")
+	if !exists {
+		return nil, false
+	}
+	permissions, ok := value.(authz.PermissionSet)
+	return permissions, ok
+}
+
+// HasPermission allows the request through only if the caller holds the permission.
 func HasPermission(permission string) gin.HandlerFunc{
-	return  func(c *gin.Context){
-		roles, exists := c.Get("roles")
-		if !exists {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "No roles found"})
+	return HasAllPermissions(permission)
+}
+
+// HasAnyPermission allows the request through if the caller holds at least one of the permissions.
+func HasAnyPermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted, ok := permissionsFrom(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "No permissions found"})
 			return
 		}
-		// Check if the user's roles have this permission
-		for _, role := range roles.([]string) {
-			if role == permission {
-				c.Next()
-				return
-			}
+		if !granted.HasAny(permissions...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// HasAllPermissions allows the request through only if the caller holds every one of the permissions.
+func HasAllPermissions(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted, ok := permissionsFrom(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "No permissions found"})
+			return
 		}
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+		if !granted.HasAll(permissions...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+			return
+		}
+		c.Next()
 	}
-}
\ No newline at end of file
+}
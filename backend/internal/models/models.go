@@ -9,16 +9,50 @@ type User struct {
     gorm.Model
     Username       string    `gorm:"unique;not null"`
     Email          string    `gorm:"unique;not null"`
-    Password       string    `gorm:"not null"`
+    CardNumber     *string   `gorm:"uniqueIndex;size:32"` // library card, printed as a barcode
+    Password       string    `gorm:"not null" json:"-"`
     ProfilePhoto   string    // Stores the file path or URL
+    DisplayName    string
+    Phone          string
+    Preferences    map[string]interface{} `gorm:"serializer:json"` // client settings, e.g. language
     IsVerified     bool      `gorm:"default:false"`
-    VerifyToken    string    
-    VerifyExpiry   time.Time 
-    ResetToken     string    
-    ResetExpiry    time.Time 
+    Status         string    `gorm:"type:varchar(20);not null;default:ACTIVE;index"` // ACTIVE, SUSPENDED, DEACTIVATED
+    StatusReason   string    // shown to the user, e.g. "unpaid fines"
+    StatusUntil    *time.Time // a suspension or deactivation lapses at this time; nil means until lifted
+    PasswordResetRequired bool `gorm:"default:false"` // set by an administrator, cleared by a reset
+    TOTPSecret     string    `json:"-"` // set on enrollment, active once TOTPEnabled
+    TOTPEnabled    bool      `gorm:"default:false"`
+    TOTPLastStep   int64     `json:"-"` // last accepted time step, prevents code replay
     Roles          []Role    `gorm:"many2many:user_roles;"`
 }
 
+// Account statuses. Suspended patrons may sign in but not borrow; deactivated
+// accounts cannot sign in or use credentials issued earlier.
+const (
+	UserActive      = "ACTIVE"
+	UserSuspended   = "SUSPENDED"
+	UserDeactivated = "DEACTIVATED"
+)
+
+// CurrentStatus is the status in effect now: a suspension or deactivation
+// with an end date lapses once it has passed.
+func (u User) CurrentStatus() string {
+	if u.Status != UserActive && u.StatusUntil != nil && !time.Now().Before(*u.StatusUntil) {
+		return UserActive
+	}
+	return u.Status
+}
+
+// CanSignIn reports whether the account may sign in.
+func (u User) CanSignIn() bool {
+	return u.CurrentStatus() != UserDeactivated
+}
+
+// CanBorrow reports whether the account may check out books.
+func (u User) CanBorrow() bool {
+	return u.CurrentStatus() == UserActive
+}
+
 type Role struct {
 	gorm.Model
 	Name string `gorm:"unique;not null"`
@@ -31,28 +65,190 @@ type Permission struct {
 	Name string `gorm:"unique;not null"`
 
 }
+// Book is a bibliographic record: one edition of a title, identified by its
+// ISBN. The library may own any number of physical copies of it.
 type Book struct {
 	gorm.Model
-	Title string `gorm:"unique;not null"`
+	Title string `gorm:"not null"`
 	Author string `gorm:"not null"`
 	ISBN string `gorm:"unique;not null"`
 	Description string `gorm:"not null"`
+	PublicationYear int `gorm:"index"` // 0 if unknown
+	Language string `gorm:"type:varchar(35);index"` // BCP 47 tag, lowercased, e.g. "en" or "pt-br"
 	CategoryID uint
 	Category Category
-	Status string // Available, CheckedOut, Reserved	
+	Status string // availability aggregated over the copies, see below
+}
+
+// Book statuses summarise the book's copies: AVAILABLE if any copy is on
+// the shelf, otherwise CHECKED_OUT if any is on loan, RESERVED if any is
+// on hold, and UNAVAILABLE if no copy can be lent at all. They follow from
+// the copies and are never set by clients.
+const (
+	BookAvailable   = "AVAILABLE"
+	BookCheckedOut  = "CHECKED_OUT"
+	BookReserved    = "RESERVED"
+	BookUnavailable = "UNAVAILABLE"
+)
+
+// Copy is one physical item of a book, labelled with its own barcode.
+// Loans lend out copies, not books.
+type Copy struct {
+	gorm.Model
+	BookID uint `gorm:"index;not null"`
+	Book Book
+	Barcode string `gorm:"type:varchar(32);uniqueIndex;not null"`
+	ShelfLocation string `gorm:"type:varchar(100)"` // call number or shelf, e.g. "530.1 FEY"
+	Condition string `gorm:"type:varchar(20);not null;default:GOOD"`
+	Status string `gorm:"type:varchar(20);not null;default:AVAILABLE;index"`
 }
+
+// Copy statuses. CHECKED_OUT is set by the loan workflow; the others by staff.
+const (
+	CopyAvailable  = "AVAILABLE"
+	CopyCheckedOut = "CHECKED_OUT"
+	CopyReserved   = "RESERVED"  // held for a patron
+	CopyInRepair   = "IN_REPAIR"
+	CopyLost       = "LOST"
+	CopyWithdrawn  = "WITHDRAWN" // no longer part of the collection
+)
+
+// Physical conditions of a copy
+const (
+	ConditionNew     = "NEW"
+	ConditionGood    = "GOOD"
+	ConditionFair    = "FAIR"
+	ConditionPoor    = "POOR"
+	ConditionDamaged = "DAMAGED"
+)
+// Category files books under a subject. Categories form a tree: a
+// category without a parent is at the top, e.g. Science, and may have
+// subcategories such as Physics. Names are unique across the whole tree.
 type Category struct {
 	gorm.Model
 	Name string `gorm:"unique;not null"`
+	ParentID *uint `gorm:"index"`
+	Parent *Category `gorm:"foreignKey:ParentID"`
 }
 type Loan struct {
     gorm.Model
     UserID      uint      `gorm:"not null"`
     User        User      `gorm:"foreignKey:UserID"`
-    BookID      uint      `gorm:"not null"`
+    BookID      uint      `gorm:"not null"` // the copy's book, kept for history and queries
     Book        Book      `gorm:"foreignKey:BookID"`
+    CopyID      uint      `gorm:"index"`
+    Copy        Copy      `gorm:"foreignKey:CopyID"`
     CheckoutDate time.Time `gorm:"not null"`
     DueDate     time.Time `gorm:"not null"`
     ReturnDate  *time.Time // Nullable for unreturned books
     Status      string    `gorm:"type:varchar(20);not null"` // ACTIVE, OVERDUE, RETURNED
-}
\ No newline at end of file
+}
+// AuditLog records an administrative change: who did it, what was done and to which record.
+type AuditLog struct {
+	gorm.Model
+	ActorID    uint   `gorm:"index;not null"`
+	Action     string `gorm:"type:varchar(50);not null"` // e.g. role.create, role.assign
+	TargetType string `gorm:"type:varchar(50);not null"`
+	TargetID   uint   `gorm:"index"`
+	Details    string
+}
+
+// Session is created for every login and records where the user signed in.
+// Access tokens carry the session ID and stop working once it is revoked.
+type Session struct {
+	gorm.Model
+	UserID     uint      `gorm:"index;not null"`
+	UserAgent  string
+	IPAddress  string    `gorm:"type:varchar(45)"`
+	LastSeenAt time.Time `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"` // expiry of the session's latest refresh token
+	RevokedAt  *time.Time
+}
+
+// RefreshToken is a long-lived credential exchanged for new access tokens.
+// Tokens issued within a session are rotated on each use, and presenting an
+// already-rotated token revokes the whole session.
+type RefreshToken struct {
+	gorm.Model
+	UserID     uint      `gorm:"index;not null"`
+	TokenHash  string    `gorm:"uniqueIndex;not null" json:"-"`
+	SessionID  uint      `gorm:"index;not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	RevokedAt  *time.Time
+	ReplacedBy *uint // ID of the token issued when this one was rotated
+}
+
+// RecoveryCode is a single-use fallback for a lost TOTP device.
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"index;not null"`
+	CodeHash string `gorm:"not null" json:"-"`
+	UsedAt   *time.Time
+}
+
+// MFAChallenge is the pending second step of a login for a user with 2FA
+// enabled; the client exchanges it together with a TOTP or recovery code.
+type MFAChallenge struct {
+	gorm.Model
+	UserID     uint      `gorm:"index;not null"`
+	TokenHash  string    `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	Attempts   int       `gorm:"default:0"`
+	ConsumedAt *time.Time
+}
+
+// ExternalIdentity links a user to an account at an external identity
+// provider, identified by the provider's issuer and subject.
+type ExternalIdentity struct {
+	gorm.Model
+	UserID   uint   `gorm:"index;not null"`
+	User     User   `gorm:"foreignKey:UserID"`
+	Provider string `gorm:"uniqueIndex:idx_provider_subject;not null"`
+	Subject  string `gorm:"uniqueIndex:idx_provider_subject;not null"`
+	Email    string
+}
+
+// APIKey is a long-lived credential a user creates for scripts. Only a hash
+// of the secret is stored; Prefix is shown to the user to tell keys apart.
+type APIKey struct {
+	gorm.Model
+	UserID     uint     `gorm:"index;not null"`
+	Name       string   `gorm:"not null"`
+	Prefix     string   `gorm:"uniqueIndex;not null"`
+	KeyHash    string   `gorm:"not null" json:"-"`
+	Scopes     []string `gorm:"serializer:json"` // permissions the key may use
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// PasswordHistory keeps hashes of a user's previous passwords so the
+// password policy can refuse their reuse.
+type PasswordHistory struct {
+	gorm.Model
+	UserID uint   `gorm:"index;not null"`
+	Hash   string `gorm:"not null" json:"-"`
+}
+
+// OneTimeToken is an emailed single-use token, e.g. for email verification
+// or a password reset. Only the hash of the token is stored.
+type OneTimeToken struct {
+	gorm.Model
+	UserID     uint      `gorm:"index;not null"`
+	Purpose    string    `gorm:"index;not null"`
+	TokenHash  string    `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	ConsumedAt *time.Time
+	RequestIP  string // address the token was requested from
+}
+
+// EmailChange is a pending change of a user's address, applied once the
+// link sent to the new address is followed.
+type EmailChange struct {
+	gorm.Model
+	UserID      uint      `gorm:"index;not null"`
+	NewEmail    string    `gorm:"not null"`
+	TokenHash   string    `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt   time.Time `gorm:"not null"`
+	ConfirmedAt *time.Time
+}
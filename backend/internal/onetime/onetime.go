@@ -0,0 +1,109 @@
+package onetime
+
+import (
+	"errors"
+	"time"
+
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidToken is returned for unknown, expired or already consumed tokens,
+// and for tokens issued for a different purpose.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Purpose says what a token may be used for; a token only redeems for the
+// purpose it was issued with.
+type Purpose string
+
+const (
+	PurposeVerifyEmail   Purpose = "verify_email"
+	PurposeResetPassword Purpose = "reset_password"
+	PurposeMagicLink     Purpose = "magic_link"
+)
+
+// Service stores emailed single-use tokens. Only a hash of each token is
+// kept, so reading the table does not let anyone redeem them.
+type Service struct {
+	db *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// WithTx returns a Service that runs on the given transaction, so a token
+// can be issued or consumed together with the change it belongs to.
+func (s *Service) WithTx(tx *gorm.DB) *Service {
+	return &Service{db: tx}
+}
+
+// Issue creates a token for the user and returns its plaintext. Earlier
+// unconsumed tokens of the user for the same purpose stop working.
+func (s *Service) Issue(userID uint, purpose Purpose, ttl time.Duration, requestIP string) (string, error) {
+	token, err := utils.GenerateVerificationToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.OneTimeToken{}).
+			Where("user_id = ? AND purpose = ? AND consumed_at IS NULL AND expires_at > ?", userID, purpose, now).
+			Update("expires_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OneTimeToken{
+			UserID:    userID,
+			Purpose:   string(purpose),
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: now.Add(ttl),
+			RequestIP: requestIP,
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Peek returns the user a still-valid token belongs to without consuming it,
+// e.g. to validate a new password before the reset token is spent.
+func (s *Service) Peek(purpose Purpose, token string) (uint, error) {
+	var record models.OneTimeToken
+	err := s.db.Where("token_hash = ? AND purpose = ? AND consumed_at IS NULL AND expires_at > ?", utils.HashToken(token), purpose, time.Now()).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	return record.UserID, nil
+}
+
+// Consume redeems a token and returns the user it was issued to. Marking it
+// consumed is a conditional update, so concurrent requests cannot both succeed.
+func (s *Service) Consume(purpose Purpose, token string) (uint, error) {
+	var record models.OneTimeToken
+	err := s.db.Where("token_hash = ? AND purpose = ?", utils.HashToken(token), purpose).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	result := s.db.Model(&models.OneTimeToken{}).
+		Where("id = ? AND consumed_at IS NULL AND expires_at > ?", record.ID, now).
+		Update("consumed_at", now)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, ErrInvalidToken
+	}
+	return record.UserID, nil
+}
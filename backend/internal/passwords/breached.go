@@ -0,0 +1,76 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BreachedList looks passwords up in a local copy of a breached-password
+// corpus stored in k-anonymity range format: a directory with one file per
+// five-character SHA-1 prefix (e.g. "5BAA6" or "5BAA6.txt"), each line of
+// which is the remaining 35 hex characters of a hash and a count,
+// "1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493". This is the layout the
+// Have I Been Pwned range downloader produces.
+type BreachedList struct {
+	dir string
+}
+
+// OpenBreachedList checks that dir exists and returns a list reading from it.
+// Range files are read on demand, so the corpus can be larger than memory.
+func OpenBreachedList(dir string) (*BreachedList, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New(dir + " is not a directory")
+	}
+	return &BreachedList{dir: dir}, nil
+}
+
+// Count returns how often the password appears in the corpus, 0 if never.
+func (b *BreachedList) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := b.openRange(prefix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		candidate, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 {
+			n = 1
+		}
+		return n, nil
+	}
+	return 0, scanner.Err()
+}
+
+func (b *BreachedList) openRange(prefix string) (*os.File, error) {
+	for _, name := range []string{prefix, prefix + ".txt", strings.ToLower(prefix), strings.ToLower(prefix) + ".txt"} {
+		file, err := os.Open(filepath.Join(b.dir, name))
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return file, err
+		}
+	}
+	return nil, fs.ErrNotExist
+}
@@ -0,0 +1,184 @@
+package passwords
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// Violation is one rule a candidate password breaks, suitable for returning
+// to the client so it can point at what to fix.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// bcryptMaxBytes is the longest password bcrypt will hash.
+const bcryptMaxBytes = 72
+
+type Config struct {
+	MinLength int
+	// MinClasses is how many of lowercase, uppercase, digits and symbols
+	// the password must mix.
+	MinClasses int
+	// DisallowUserInfo rejects passwords containing the username or the
+	// local part of the email address.
+	DisallowUserInfo bool
+	// HistorySize is how many previous passwords, besides the current one,
+	// may not be reused. Every entry costs a bcrypt comparison on change.
+	HistorySize int
+	// Breached, if set, rejects passwords found in a breach corpus.
+	Breached *BreachedList
+}
+
+// Policy validates new passwords and remembers old ones.
+type Policy struct {
+	db     *gorm.DB
+	config Config
+}
+
+func NewPolicy(db *gorm.DB, cfg Config) *Policy {
+	if cfg.MinLength == 0 {
+		cfg.MinLength = 8
+	}
+	return &Policy{db: db, config: cfg}
+}
+
+// Check returns every rule the password breaks for the given account. For a
+// new account user.ID is zero and no history is consulted.
+func (p *Policy) Check(user models.User, password string) ([]Violation, error) {
+	var violations []Violation
+	add := func(code, format string, args ...interface{}) {
+		violations = append(violations, Violation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if utf8.RuneCountInString(password) < p.config.MinLength {
+		add("too_short", "Password must be at least %d characters long", p.config.MinLength)
+	}
+	if len(password) > bcryptMaxBytes {
+		add("too_long", "Password must be at most %d bytes long", bcryptMaxBytes)
+	}
+	if classes := characterClasses(password); classes < p.config.MinClasses {
+		add("too_simple", "Password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.config.MinClasses)
+	}
+	if p.config.DisallowUserInfo && containsUserInfo(password, user) {
+		add("contains_user_info", "Password must not contain your username or email address")
+	}
+
+	if p.config.Breached != nil {
+		count, err := p.config.Breached.Count(password)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			add("breached", "Password has appeared in a data breach and must not be used")
+		}
+	}
+
+	// History is checked last: bcrypt is slow, and a password already
+	// rejected for another reason does not need it.
+	if len(violations) == 0 && user.ID != 0 {
+		reused, err := p.reused(user, password)
+		if err != nil {
+			return nil, err
+		}
+		if reused {
+			add("reused", "Password must differ from your current and recent passwords")
+		}
+	}
+
+	return violations, nil
+}
+
+// reused reports whether the password matches the current one or one of the
+// remembered previous ones.
+func (p *Policy) reused(user models.User, password string) (bool, error) {
+	if user.Password != "" && utils.CheckPasswordHash(password, user.Password) {
+		return true, nil
+	}
+	if p.config.HistorySize == 0 {
+		return false, nil
+	}
+
+	var history []models.PasswordHistory
+	err := p.db.Where("user_id = ?", user.ID).
+		Order("created_at DESC").
+		Limit(p.config.HistorySize).
+		Find(&history).Error
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range history {
+		if utils.CheckPasswordHash(password, entry.Hash) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Remember records the hash a user is moving away from and drops entries
+// beyond the configured history. Call it in the same transaction that
+// stores the new password.
+func (p *Policy) Remember(tx *gorm.DB, userID uint, oldHash string) error {
+	if p.config.HistorySize == 0 || oldHash == "" {
+		return nil
+	}
+	if err := tx.Create(&models.PasswordHistory{UserID: userID, Hash: oldHash}).Error; err != nil {
+		return err
+	}
+
+	var stale []uint
+	err := tx.Model(&models.PasswordHistory{}).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Offset(p.config.HistorySize).
+		Pluck("id", &stale).Error
+	if err != nil || len(stale) == 0 {
+		return err
+	}
+	return tx.Unscoped().Delete(&models.PasswordHistory{}, stale).Error
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, has := range []bool{lower, upper, digit, symbol} {
+		if has {
+			classes++
+		}
+	}
+	return classes
+}
+
+// minUserInfoLength keeps very short usernames, like "al", from ruling out
+// every password that happens to contain them.
+const minUserInfoLength = 3
+
+func containsUserInfo(password string, user models.User) bool {
+	lowered := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(user.Email, "@")
+	for _, info := range []string{user.Username, localPart} {
+		info = strings.ToLower(info)
+		if len(info) >= minUserInfoLength && strings.Contains(lowered, info) {
+			return true
+		}
+	}
+	return false
+}
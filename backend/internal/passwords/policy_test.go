@@ -0,0 +1,145 @@
+package passwords
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/testdb"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func codes(t *testing.T, p *Policy, user models.User, password string) []string {
+	t.Helper()
+	violations, err := p.Check(user, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := []string{}
+	for _, v := range violations {
+		found = append(found, v.Code)
+	}
+	return found
+}
+
+func TestCheckRules(t *testing.T) {
+	p := NewPolicy(nil, Config{MinLength: 10, MinClasses: 3, DisallowUserInfo: true})
+	user := models.User{Username: "alice", Email: "wonderland@example.com"}
+
+	for _, tc := range []struct {
+		password string
+		want     []string
+	}{
+		{"Correct-Horse-9", []string{}},
+		{"Short-9", []string{"too_short"}},
+		{"alllowercaseletters", []string{"too_simple"}},
+		{"Alice-In-Chains-9", []string{"contains_user_info"}},
+		{"My-WONDERLAND-9", []string{"contains_user_info"}},
+		{"Ab1-" + strings.Repeat("x", 70), []string{"too_long"}},
+		{"alice", []string{"too_short", "too_simple", "contains_user_info"}},
+		// Length counts characters, not bytes
+		{"Ünïcödé-ß-1", []string{}},
+	} {
+		if got := codes(t, p, user, tc.password); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Check(%q) = %v, want %v", tc.password, got, tc.want)
+		}
+	}
+}
+
+func TestShortUserInfoIsIgnored(t *testing.T) {
+	p := NewPolicy(nil, Config{DisallowUserInfo: true})
+	user := models.User{Username: "al", Email: "al@example.com"}
+	if got := codes(t, p, user, "always-alert"); len(got) != 0 {
+		t.Errorf("Check = %v, want no violations", got)
+	}
+}
+
+func TestMinLengthDefaultsToEight(t *testing.T) {
+	p := NewPolicy(nil, Config{})
+	if got := codes(t, p, models.User{}, "1234567"); !reflect.DeepEqual(got, []string{"too_short"}) {
+		t.Errorf("Check(7 characters) = %v, want [too_short]", got)
+	}
+	if got := codes(t, p, models.User{}, "12345678"); len(got) != 0 {
+		t.Errorf("Check(8 characters) = %v, want no violations", got)
+	}
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	dir := t.TempDir()
+	sum := sha1.Sum([]byte("Password123!"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	rangeFile := "0000000000000000000000000000000000A:2\n" + strings.ToLower(hash[5:]) + ":3861493\n"
+	if err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(rangeFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := OpenBreachedList(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count, err := list.Count("Password123!"); err != nil || count != 3861493 {
+		t.Errorf("Count(breached) = %d, %v; want 3861493", count, err)
+	}
+	if count, err := list.Count("Unlisted-Password-7"); err != nil || count != 0 {
+		t.Errorf("Count(unlisted) = %d, %v; want 0", count, err)
+	}
+
+	p := NewPolicy(nil, Config{Breached: list})
+	if got := codes(t, p, models.User{}, "Password123!"); !reflect.DeepEqual(got, []string{"breached"}) {
+		t.Errorf("Check(breached) = %v, want [breached]", got)
+	}
+}
+
+func TestHistoryRejectsRecentPasswords(t *testing.T) {
+	db := testdb.Open(t, &models.User{}, &models.PasswordHistory{})
+	p := NewPolicy(db, Config{HistorySize: 2})
+
+	// Hashed cheaply: checks take the cost from the hash
+	hash := func(password string) string {
+		t.Helper()
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(hashed)
+	}
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: hash("first-password")}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Move through three passwords, remembering each one left behind
+	for _, next := range []string{"second-password", "third-password", "fourth-password"} {
+		if err := p.Remember(db, user.ID, user.Password); err != nil {
+			t.Fatal(err)
+		}
+		user.Password = hash(next)
+	}
+
+	var kept int64
+	db.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).Count(&kept)
+	if kept != 2 {
+		t.Errorf("%d history entries kept, want 2", kept)
+	}
+
+	for password, want := range map[string][]string{
+		"fourth-password": {"reused"}, // the current one
+		"third-password":  {"reused"},
+		"second-password": {"reused"},
+		"first-password":  {}, // beyond the history
+	} {
+		if got := codes(t, p, user, password); !reflect.DeepEqual(got, want) {
+			t.Errorf("Check(%q) = %v, want %v", password, got, want)
+		}
+	}
+
+	// New accounts have no history to check
+	if got := codes(t, p, models.User{}, "third-password"); len(got) != 0 {
+		t.Errorf("Check for a new account = %v, want no violations", got)
+	}
+}
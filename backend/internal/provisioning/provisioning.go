@@ -0,0 +1,284 @@
+package provisioning
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/librarycard"
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrEmailTaken is returned when a new external account would reuse the
+	// email of an existing user. Accounts are never linked by email, as
+	// whoever controls the address at the provider would take over the
+	// local account; its owner signs in and links the provider instead.
+	ErrEmailTaken = errors.New("an account with this email already exists")
+	// ErrIdentityLinked is returned when linking an external account that
+	// already belongs to another user.
+	ErrIdentityLinked = errors.New("this external account is already linked to another user")
+)
+
+// ExternalUser is an account asserted by an external identity provider. It
+// is identified by Provider and Subject alone; the email only seeds a new
+// user and never selects an existing one.
+type ExternalUser struct {
+	Provider string // e.g. the OIDC issuer or LDAP server URL
+	Subject  string // stable identifier of the account at the provider
+	Username string
+	Email    string
+	Groups   []string
+}
+
+// RoleMapping maps an external group name to the library roles it grants.
+type RoleMapping map[string][]string
+
+// ParseRoleMapping parses "group=role,group=role" pairs. A group may be
+// listed several times to grant more than one role.
+func ParseRoleMapping(spec string) (RoleMapping, error) {
+	mapping := RoleMapping{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || role == "" {
+			return nil, fmt.Errorf("invalid group mapping %q: want group=role", pair)
+		}
+		mapping[group] = append(mapping[group], role)
+	}
+	return mapping, nil
+}
+
+// roles returns the roles granted by the groups and every role the mapping
+// manages at all.
+func (m RoleMapping) roles(groups []string) (granted, managed map[string]bool) {
+	granted, managed = map[string]bool{}, map[string]bool{}
+	for _, roles := range m {
+		for _, role := range roles {
+			managed[role] = true
+		}
+	}
+	for _, group := range groups {
+		for _, role := range m[group] {
+			granted[role] = true
+		}
+	}
+	return granted, managed
+}
+
+type Config struct {
+	Mapping RoleMapping
+	// DefaultRole is granted to users who end up with no role at all.
+	DefaultRole string
+}
+
+// Service links external accounts to library users, creating users just in
+// time and keeping their mapped roles in sync with the provider's groups.
+type Service struct {
+	db     *gorm.DB
+	authz  *authz.Service
+	cards  *librarycard.Service
+	config Config
+}
+
+func NewService(db *gorm.DB, authzService *authz.Service, cardService *librarycard.Service, cfg Config) *Service {
+	return &Service{db: db, authz: authzService, cards: cardService, config: cfg}
+}
+
+// Provision returns the library user linked to the external account,
+// creating one on first sign-in, with roles loaded.
+func (s *Service) Provision(ext ExternalUser) (*models.User, error) {
+	var user models.User
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var identity models.ExternalIdentity
+		err := tx.Where("provider = ? AND subject = ?", ext.Provider, ext.Subject).First(&identity).Error
+		switch {
+		case err == nil:
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := s.create(tx, ext, &user); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		if err := s.syncRoles(tx, &user, ext.Groups); err != nil {
+			return err
+		}
+		return tx.Preload("Roles").First(&user, user.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.authz.Invalidate(user.ID)
+	return &user, nil
+}
+
+// create makes a new user for the external account and links it.
+func (s *Service) create(tx *gorm.DB, ext ExternalUser, user *models.User) error {
+	var count int64
+	if err := tx.Unscoped().Model(&models.User{}).Where("LOWER(email) = LOWER(?)", ext.Email).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrEmailTaken
+	}
+
+	if err := s.createUser(tx, ext, user); err != nil {
+		return err
+	}
+	return link(tx, user.ID, ext)
+}
+
+// Link attaches the external account to an existing user, who must be
+// signed in to ask for it. Roles are not synced until the user next signs
+// in through the provider.
+func (s *Service) Link(userID uint, ext ExternalUser) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var identity models.ExternalIdentity
+		err := tx.Where("provider = ? AND subject = ?", ext.Provider, ext.Subject).First(&identity).Error
+		switch {
+		case err == nil && identity.UserID == userID:
+			return nil
+		case err == nil:
+			return ErrIdentityLinked
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+		return link(tx, userID, ext)
+	})
+}
+
+func link(tx *gorm.DB, userID uint, ext ExternalUser) error {
+	identity := models.ExternalIdentity{
+		UserID:   userID,
+		Provider: ext.Provider,
+		Subject:  ext.Subject,
+		Email:    ext.Email,
+	}
+	return tx.Create(&identity).Error
+}
+
+func (s *Service) createUser(tx *gorm.DB, ext ExternalUser, user *models.User) error {
+	username, err := uniqueUsername(tx, ext)
+	if err != nil {
+		return err
+	}
+
+	// External users sign in through their provider; the random password
+	// only exists to satisfy the column and is never disclosed.
+	secret, err := utils.GenerateVerificationToken()
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := utils.HashPassword(secret)
+	if err != nil {
+		return err
+	}
+
+	*user = models.User{
+		Username:   username,
+		Email:      ext.Email,
+		Password:   hashedPassword,
+		IsVerified: true,
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+
+	number, err := s.cards.Assign(tx, user.ID)
+	if err != nil {
+		return err
+	}
+	user.CardNumber = &number
+	return nil
+}
+
+// syncRoles grants the roles mapped from the user's groups and removes mapped
+// roles whose group membership is gone. Roles outside the mapping, e.g. ones
+// assigned by an administrator, are left alone.
+func (s *Service) syncRoles(tx *gorm.DB, user *models.User, groups []string) error {
+	granted, managed := s.config.Mapping.roles(groups)
+
+	var current []models.Role
+	if err := tx.Model(user).Association("Roles").Find(&current); err != nil {
+		return err
+	}
+	has := map[string]bool{}
+	var remove []models.Role
+	for _, role := range current {
+		has[role.Name] = true
+		if managed[role.Name] && !granted[role.Name] {
+			remove = append(remove, role)
+		}
+	}
+
+	if len(current) == len(remove) && len(granted) == 0 && s.config.DefaultRole != "" {
+		granted[s.config.DefaultRole] = true
+	}
+
+	var add []string
+	for name := range granted {
+		if !has[name] {
+			add = append(add, name)
+		}
+	}
+
+	if len(remove) > 0 {
+		if err := tx.Model(user).Association("Roles").Delete(remove); err != nil {
+			return err
+		}
+	}
+	if len(add) > 0 {
+		var roles []models.Role
+		if err := tx.Where("name IN ?", add).Find(&roles).Error; err != nil {
+			return err
+		}
+		if len(roles) > 0 {
+			if err := tx.Model(user).Association("Roles").Append(roles); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// uniqueUsername derives a free username from the external account,
+// appending a number if the preferred one is taken.
+func uniqueUsername(tx *gorm.DB, ext ExternalUser) (string, error) {
+	base := ext.Username
+	if base == "" {
+		base, _, _ = strings.Cut(ext.Email, "@")
+	}
+	base = usernameInvalidChars.ReplaceAllString(base, "")
+	if base == "" {
+		base = "user"
+	}
+
+	candidate := base
+	for i := 2; ; i++ {
+		var count int64
+		if err := tx.Unscoped().Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+}
@@ -1,32 +1,122 @@
 package routes
 
 import (
+	"time"
+	"digital-library/backend/internal/apikeys"
+	"digital-library/backend/internal/authn"
 	"digital-library/backend/internal/controllers"
+	"digital-library/backend/internal/emailchange"
+	"digital-library/backend/internal/librarycard"
+	"digital-library/backend/internal/magiclink"
 	"digital-library/backend/pkg/email"
+	"digital-library/backend/internal/mfa"
 	"digital-library/backend/internal/middleware"
+	"digital-library/backend/internal/onetime"
+	"digital-library/backend/internal/passwords"
+	"digital-library/backend/internal/throttle"
+	"digital-library/backend/internal/tokens"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func SetupAuthRoutes(r *gin.Engine, db *gorm.DB, emailService *email.Service) {
+// Login throttling: each failure doubles the wait before the next attempt;
+// usernames are locked after repeated failures, IPs are only slowed down.
+var (
+    loginUserThrottle = throttle.Config{
+        MaxFailures:     5,
+        LockoutDuration: 15 * time.Minute,
+        BaseDelay:       time.Second,
+        MaxDelay:        time.Minute,
+        Window:          time.Hour,
+    }
+    loginIPThrottle = throttle.Config{
+        BaseDelay: 250 * time.Millisecond,
+        MaxDelay:  5 * time.Minute,
+        Window:    time.Hour,
+    }
+    // Each sign-in link request for an address doubles the wait before the
+    // next one; the address is blocked for an hour after five.
+    magicLinkThrottle = throttle.Config{
+        MaxFailures:     5,
+        LockoutDuration: time.Hour,
+        BaseDelay:       time.Minute,
+        MaxDelay:        15 * time.Minute,
+        Window:          time.Hour,
+    }
+    // Verification emails can be resent to an address once a minute at
+    // first, backing off to every 15 minutes.
+    verificationThrottle = throttle.Config{
+        BaseDelay: time.Minute,
+        MaxDelay:  15 * time.Minute,
+        Window:    time.Hour,
+    }
+)
+
+// Lifetimes of emailed links
+const (
+    magicLinkTTL   = 15 * time.Minute
+    emailChangeTTL = 24 * time.Hour
+)
+
+func SetupAuthRoutes(r *gin.Engine, db *gorm.DB, emailService *email.Service, tokenService *tokens.Service, mfaService *mfa.Service, apiKeyService *apikeys.Service, passwordPolicy *passwords.Policy, cardService *librarycard.Service, authenticators authn.Chain, authenticator *middleware.Authenticator) {
+    oneTimeTokens := onetime.NewService(db)
     authCtrl := &controllers.AuthController{
-        DB:    db,
-        Email: emailService,
+        DB:                  db,
+        Email:               emailService,
+        Tokens:              tokenService,
+        MFA:                 mfaService,
+        APIKeys:             apiKeyService,
+        Passwords:           passwordPolicy,
+        Authenticators:      authenticators,
+        UserLimiter:         throttle.NewLimiter(throttle.NewMemoryStore(), loginUserThrottle),
+        IPLimiter:           throttle.NewLimiter(throttle.NewMemoryStore(), loginIPThrottle),
+        MagicLinks:          magiclink.NewService(db, oneTimeTokens, magicLinkTTL),
+        MagicLinkLimiter:    throttle.NewLimiter(throttle.NewMemoryStore(), magicLinkThrottle),
+        OneTimeTokens:       oneTimeTokens,
+        VerificationLimiter: throttle.NewLimiter(throttle.NewMemoryStore(), verificationThrottle),
+        EmailChanges:        emailchange.NewService(db, emailChangeTTL),
+        Cards:               cardService,
     }
 
+    r.GET("/.well-known/jwks.json", authCtrl.JWKS)
+
     auth := r.Group("/auth")
     {
         auth.POST("/register", authCtrl.Register)
         auth.GET("/verify-email", authCtrl.VerifyEmail)
+        auth.POST("/resend-verification", authCtrl.ResendVerification)
         auth.POST("/login", authCtrl.Login)
+        auth.POST("/login/2fa", authCtrl.VerifyTwoFactorLogin)
+        auth.POST("/magic-link", authCtrl.RequestMagicLink)
+        auth.GET("/magic-link/verify", authCtrl.ShowMagicLink)
+        auth.POST("/magic-link/verify", authCtrl.ConsumeMagicLink)
+        auth.GET("/email-change/confirm", authCtrl.ConfirmEmailChange)
         auth.POST("/forgot-password", authCtrl.ForgotPassword)
         auth.POST("/reset-password", authCtrl.ResetPassword)
+        auth.POST("/refresh", authCtrl.Refresh)
+        auth.POST("/logout", authCtrl.Logout)
         
         // Protected routes
-        auth.Use(middleware.JWTAuth())
+        auth.Use(authenticator.JWTAuth())
         {
             auth.POST("/upload-profile-photo", authCtrl.UploadProfilePhoto)
             auth.GET("/users/:userID/profile-photo", authCtrl.GetProfilePhoto)
+            auth.POST("/users/:userID/logout-all", middleware.HasPermission("manage_users"), authCtrl.LogoutUser)
+            auth.POST("/users/:userID/unlock", middleware.HasPermission("manage_users"), authCtrl.UnlockUser)
+
+            // Credential management needs an interactive login, not an API key
+            credentials := auth.Group("", middleware.RequireSession())
+            credentials.POST("/2fa/enroll", authCtrl.EnrollTwoFactor)
+            credentials.POST("/2fa/confirm", authCtrl.ConfirmTwoFactor)
+            credentials.POST("/2fa/disable", authCtrl.DisableTwoFactor)
+            credentials.POST("/2fa/recovery-codes", authCtrl.RegenerateRecoveryCodes)
+            credentials.GET("/sessions", authCtrl.GetSessions)
+            credentials.DELETE("/sessions/:id", authCtrl.RevokeSession)
+            credentials.POST("/logout-all", authCtrl.LogoutAll)
+            credentials.POST("/api-keys", authCtrl.CreateAPIKey)
+            credentials.GET("/api-keys", authCtrl.GetAPIKeys)
+            credentials.DELETE("/api-keys/:id", authCtrl.RevokeAPIKey)
+            credentials.POST("/email-change", authCtrl.RequestEmailChange)
         }
     }
 }
\ No newline at end of file
@@ -3,25 +3,27 @@ package routes
 import (
 	"digital-library/backend/internal/controllers"
 	"digital-library/backend/internal/middleware"
+	"digital-library/backend/internal/search"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func SetupBookRoutes(r *gin.Engine, db *gorm.DB) {
-	bookCtrl := &controllers.BookController{DB: db}
+func SetupBookRoutes(r *gin.Engine, db *gorm.DB, searchEngine search.Engine, authenticator *middleware.Authenticator) {
+	bookCtrl := &controllers.BookController{DB: db, Search: searchEngine}
 
 	// All book routes require JWT
 	bookRoutes := r.Group("/books")
-	bookRoutes.Use(middleware.JWTAuth())
+	bookRoutes.Use(authenticator.JWTAuth())
 	{
-		// Viewingwsl
-		
-		bookRoutes.GET("/", bookCtrl.GetBooks)  
-		bookRoutes.GET("/:id", bookCtrl.GetBook) 
+		// Viewing
+		bookRoutes.GET("/", middleware.HasPermission("view_books"), bookCtrl.GetBooks)
+		bookRoutes.GET("/search", middleware.HasPermission("view_books"), bookCtrl.SearchBooks)
+		bookRoutes.GET("/:id", middleware.HasPermission("view_books"), bookCtrl.GetBook)
 
 		// Modification (with extra permissions)
 		bookRoutes.POST("/", middleware.HasPermission("create_book"), bookCtrl.CreateBook)
 		bookRoutes.PUT("/:id", middleware.HasPermission("edit_book"), bookCtrl.UpdateBook)
+		bookRoutes.PATCH("/:id", middleware.HasPermission("edit_book"), bookCtrl.UpdateBook)
 		bookRoutes.DELETE("/:id", middleware.HasPermission("delete_book"), bookCtrl.DeleteBook)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"digital-library/backend/internal/controllers"
+	"digital-library/backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func SetupCategoryRoutes(r *gin.Engine, db *gorm.DB, authenticator *middleware.Authenticator) {
+	categoryCtrl := &controllers.CategoryController{DB: db}
+
+	categoryRoutes := r.Group("/categories")
+	categoryRoutes.Use(authenticator.JWTAuth())
+	{
+		// Anyone who can browse books can browse their categories
+		categoryRoutes.GET("/", middleware.HasPermission("view_books"), categoryCtrl.GetCategories)
+		categoryRoutes.GET("/:id", middleware.HasPermission("view_books"), categoryCtrl.GetCategory)
+
+		categoryRoutes.POST("/", middleware.HasPermission("manage_categories"), categoryCtrl.CreateCategory)
+		categoryRoutes.PUT("/:id", middleware.HasPermission("manage_categories"), categoryCtrl.RenameCategory)
+		categoryRoutes.PATCH("/:id", middleware.HasPermission("manage_categories"), categoryCtrl.RenameCategory)
+		categoryRoutes.POST("/:id/move", middleware.HasPermission("manage_categories"), categoryCtrl.MoveCategory)
+		categoryRoutes.POST("/:id/merge", middleware.HasPermission("manage_categories"), categoryCtrl.MergeCategory)
+		categoryRoutes.DELETE("/:id", middleware.HasPermission("manage_categories"), categoryCtrl.DeleteCategory)
+	}
+}
@@ -0,0 +1,190 @@
+package routes
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"digital-library/backend/internal/authn"
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/librarycard"
+	"digital-library/backend/internal/passwords"
+	"digital-library/backend/internal/provisioning"
+	"digital-library/backend/internal/search"
+	"digital-library/backend/internal/sso"
+	"gorm.io/gorm"
+)
+
+// splitList splits a comma-separated environment value, dropping blanks.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// mfaRequiredPermissions reads the permissions whose holders must use 2FA from
+// MFA_REQUIRED_PERMISSIONS (comma-separated, "none" to disable), defaulting to
+// the permissions that allow destructive or administrative changes.
+func mfaRequiredPermissions() []string {
+	value, ok := os.LookupEnv("MFA_REQUIRED_PERMISSIONS")
+	if !ok {
+		return []string{"delete_book", "manage_users"}
+	}
+	if value == "none" {
+		return nil
+	}
+	return splitList(value)
+}
+
+// provisioningFromEnv builds the user provisioning for an external identity
+// provider from <PREFIX>_GROUP_ROLES ("group=role,...") and
+// <PREFIX>_DEFAULT_ROLE (defaults to "user").
+func provisioningFromEnv(prefix string, db *gorm.DB, authzService *authz.Service, cardService *librarycard.Service) *provisioning.Service {
+	mapping, err := provisioning.ParseRoleMapping(os.Getenv(prefix + "_GROUP_ROLES"))
+	if err != nil {
+		log.Fatalf("Invalid %s_GROUP_ROLES: %v", prefix, err)
+	}
+
+	defaultRole, ok := os.LookupEnv(prefix + "_DEFAULT_ROLE")
+	if !ok {
+		defaultRole = "user"
+	}
+
+	return provisioning.NewService(db, authzService, cardService, provisioning.Config{
+		Mapping:     mapping,
+		DefaultRole: defaultRole,
+	})
+}
+
+// authenticatorsFromEnv builds the login backends named in AUTH_BACKENDS
+// (comma-separated, tried in order; default "local").
+func authenticatorsFromEnv(db *gorm.DB, authzService *authz.Service, cardService *librarycard.Service) authn.Chain {
+	names := splitList(os.Getenv("AUTH_BACKENDS"))
+	if len(names) == 0 {
+		names = []string{"local"}
+	}
+
+	var chain authn.Chain
+	for _, name := range names {
+		switch name {
+		case "local":
+			chain = append(chain, &authn.PasswordAuthenticator{DB: db})
+		case "ldap":
+			chain = append(chain, ldapFromEnv(db, authzService, cardService))
+		default:
+			log.Fatalf("Unknown authentication backend %q in AUTH_BACKENDS", name)
+		}
+	}
+	return chain
+}
+
+// ldapFromEnv configures LDAP bind authentication from LDAP_* variables.
+func ldapFromEnv(db *gorm.DB, authzService *authz.Service, cardService *librarycard.Service) *authn.LDAPAuthenticator {
+	cfg := authn.LDAPConfig{
+		URL:               os.Getenv("LDAP_URL"),
+		StartTLS:          os.Getenv("LDAP_START_TLS") == "true",
+		BindDN:            os.Getenv("LDAP_BIND_DN"),
+		BindPassword:      os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:            os.Getenv("LDAP_BASE_DN"),
+		UserFilter:        os.Getenv("LDAP_USER_FILTER"),
+		UsernameAttribute: os.Getenv("LDAP_USERNAME_ATTRIBUTE"),
+		EmailAttribute:    os.Getenv("LDAP_EMAIL_ATTRIBUTE"),
+		IDAttribute:       os.Getenv("LDAP_ID_ATTRIBUTE"),
+		GroupAttribute:    os.Getenv("LDAP_GROUP_ATTRIBUTE"),
+	}
+	if !cfg.Enabled() {
+		log.Fatal("AUTH_BACKENDS includes ldap but LDAP_URL or LDAP_BASE_DN is not set")
+	}
+	return authn.NewLDAPAuthenticator(cfg, provisioningFromEnv("LDAP", db, authzService, cardService))
+}
+
+// ssoFromEnv configures OpenID Connect login. It stays disabled unless
+// OIDC_ISSUER and OIDC_CLIENT_ID are set.
+func ssoFromEnv(db *gorm.DB, authzService *authz.Service, cardService *librarycard.Service) *sso.Service {
+	return sso.NewService(sso.Config{
+		IssuerURL:    os.Getenv("OIDC_ISSUER"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       splitList(os.Getenv("OIDC_SCOPES")),
+		GroupsClaim:  os.Getenv("OIDC_GROUPS_CLAIM"),
+	}, provisioningFromEnv("OIDC", db, authzService, cardService))
+}
+
+// intFromEnv reads a non-negative integer variable, falling back to def when unset.
+func intFromEnv(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Fatalf("Invalid %s: want a non-negative integer", name)
+	}
+	return n
+}
+
+// passwordPolicyFromEnv configures the password policy from PASSWORD_*
+// variables. PASSWORD_BREACHED_DIR points at a breach corpus in k-anonymity
+// range format; the check is skipped when it is unset.
+func passwordPolicyFromEnv(db *gorm.DB) *passwords.Policy {
+	cfg := passwords.Config{
+		MinLength:        intFromEnv("PASSWORD_MIN_LENGTH", 8),
+		MinClasses:       intFromEnv("PASSWORD_MIN_CLASSES", 2),
+		DisallowUserInfo: os.Getenv("PASSWORD_ALLOW_USER_INFO") != "true",
+		HistorySize:      intFromEnv("PASSWORD_HISTORY", 3),
+	}
+	if dir := os.Getenv("PASSWORD_BREACHED_DIR"); dir != "" {
+		breached, err := passwords.OpenBreachedList(dir)
+		if err != nil {
+			log.Fatalf("Invalid PASSWORD_BREACHED_DIR: %v", err)
+		}
+		cfg.Breached = breached
+	}
+	return passwords.NewPolicy(db, cfg)
+}
+
+// libraryCardsFromEnv configures card numbers from LIBRARY_CARD_PREFIX
+// (digits, default "2") and LIBRARY_CARD_LENGTH (all digits including the
+// prefix and check digit, default 14).
+func libraryCardsFromEnv(db *gorm.DB) *librarycard.Service {
+	prefix, ok := os.LookupEnv("LIBRARY_CARD_PREFIX")
+	if !ok {
+		prefix = "2"
+	}
+	if strings.Trim(prefix, "0123456789") != "" {
+		log.Fatal("Invalid LIBRARY_CARD_PREFIX: want digits only")
+	}
+
+	// Fewer than eight random digits makes collisions, and guessing, too easy
+	length := intFromEnv("LIBRARY_CARD_LENGTH", 14)
+	if length < len(prefix)+9 || length > 32 {
+		log.Fatalf("Invalid LIBRARY_CARD_LENGTH: want between %d and 32", len(prefix)+9)
+	}
+
+	return librarycard.NewService(db, librarycard.Config{Prefix: prefix, Length: length})
+}
+
+// searchEngineFromEnv picks the book search engine named by SEARCH_ENGINE:
+// "postgres" (default) uses the database's full-text search, "memory" an
+// in-process index built at startup.
+func searchEngineFromEnv(db *gorm.DB) search.Engine {
+	switch name := os.Getenv("SEARCH_ENGINE"); name {
+	case "", "postgres":
+		return search.NewPostgres(db)
+	case "memory":
+		engine := search.NewMemory()
+		if err := search.Sync(db, engine); err != nil {
+			log.Fatalf("Failed to build search index: %v", err)
+		}
+		return engine
+	default:
+		log.Fatalf("Unknown search engine %q in SEARCH_ENGINE", name)
+		return nil
+	}
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"digital-library/backend/internal/controllers"
+	"digital-library/backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func SetupCopyRoutes(r *gin.Engine, db *gorm.DB, authenticator *middleware.Authenticator) {
+	copyCtrl := &controllers.CopyController{DB: db}
+
+	// Copies are managed with the same permissions as their books
+	bookCopyRoutes := r.Group("/books/:id/copies")
+	bookCopyRoutes.Use(authenticator.JWTAuth())
+	{
+		bookCopyRoutes.GET("/", middleware.HasPermission("view_books"), copyCtrl.GetBookCopies)
+		bookCopyRoutes.POST("/", middleware.HasPermission("create_book"), copyCtrl.AddCopy)
+	}
+
+	copyRoutes := r.Group("/copies")
+	copyRoutes.Use(authenticator.JWTAuth())
+	{
+		copyRoutes.GET("/barcode/:barcode", middleware.HasPermission("view_books"), copyCtrl.GetCopyByBarcode)
+		copyRoutes.GET("/:id", middleware.HasPermission("view_books"), copyCtrl.GetCopy)
+		copyRoutes.PUT("/:id", middleware.HasPermission("edit_book"), copyCtrl.UpdateCopy)
+		copyRoutes.PATCH("/:id", middleware.HasPermission("edit_book"), copyCtrl.UpdateCopy)
+		copyRoutes.DELETE("/:id", middleware.HasPermission("delete_book"), copyCtrl.DeleteCopy)
+	}
+}
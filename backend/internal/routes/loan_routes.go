@@ -7,15 +7,16 @@ import (
 	"gorm.io/gorm"
 )
 
-func SetupLoanRoutes(r *gin.Engine, db *gorm.DB) {
+func SetupLoanRoutes(r *gin.Engine, db *gorm.DB, authenticator *middleware.Authenticator) {
 	loanCtrl := &controllers.LoanController{DB: db}
 
 	// All loan routes require JWT
 	loanRoutes := r.Group("/loans")
-	loanRoutes.Use(middleware.JWTAuth())
+	loanRoutes.Use(authenticator.JWTAuth())
 	{
 		loanRoutes.POST("/", middleware.HasPermission("checkout_book"), loanCtrl.CheckoutBook)
 		loanRoutes.PUT("/:id/return", middleware.HasPermission("return_book"), loanCtrl.ReturnBook)
-		loanRoutes.GET("/user/:user_id", loanCtrl.GetUserLoans) // Requires auth
+		loanRoutes.GET("/user/:user_id", middleware.HasAnyPermission("view_loans", "manage_overdue"), loanCtrl.GetUserLoans)
+		loanRoutes.GET("/overdue", middleware.HasPermission("manage_overdue"), loanCtrl.GetOverdueLoans)
 	}
 }
\ No newline at end of file
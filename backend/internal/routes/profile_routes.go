@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/controllers"
+	"digital-library/backend/internal/middleware"
+	"digital-library/backend/internal/passwords"
+	"digital-library/backend/internal/tokens"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func SetupProfileRoutes(r *gin.Engine, db *gorm.DB, tokenService *tokens.Service, passwordPolicy *passwords.Policy, authzService *authz.Service, authenticator *middleware.Authenticator) {
+	profileCtrl := &controllers.ProfileController{
+		DB:        db,
+		Tokens:    tokenService,
+		Passwords: passwordPolicy,
+		Authz:     authzService,
+	}
+
+	// Every signed-in user manages their own account; no permission needed
+	me := r.Group("/me")
+	me.Use(authenticator.JWTAuth())
+	{
+		me.GET("", profileCtrl.GetMe)
+		me.PATCH("", profileCtrl.UpdateMe)
+		me.GET("/export", profileCtrl.ExportMe)
+		me.GET("/card/barcode", profileCtrl.GetMyCardBarcode)
+
+		// Changing the password or deleting the account needs an interactive login
+		me.POST("/password", middleware.RequireSession(), profileCtrl.ChangePassword)
+		me.DELETE("", middleware.RequireSession(), profileCtrl.DeleteMe)
+	}
+}
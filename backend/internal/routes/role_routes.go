@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/controllers"
+	"digital-library/backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func SetupRoleRoutes(r *gin.Engine, db *gorm.DB, authzService *authz.Service, authenticator *middleware.Authenticator) {
+	roleCtrl := &controllers.RoleController{DB: db, Authz: authzService}
+	permissionCtrl := &controllers.PermissionController{DB: db, Authz: authzService}
+	auditCtrl := &controllers.AuditController{DB: db}
+
+	// Access management is restricted to users who can manage users
+	roleRoutes := r.Group("/roles")
+	roleRoutes.Use(authenticator.JWTAuth(), middleware.HasPermission("manage_users"))
+	{
+		roleRoutes.GET("/", roleCtrl.GetRoles)
+		roleRoutes.GET("/:id", roleCtrl.GetRole)
+		roleRoutes.POST("/", roleCtrl.CreateRole)
+		roleRoutes.PUT("/:id", roleCtrl.UpdateRole)
+		roleRoutes.DELETE("/:id", roleCtrl.DeleteRole)
+
+		roleRoutes.POST("/:id/permissions", roleCtrl.AttachPermissions)
+		roleRoutes.DELETE("/:id/permissions/:permission", roleCtrl.DetachPermission)
+
+		roleRoutes.POST("/:id/users/:userID", roleCtrl.AssignRole)
+		roleRoutes.DELETE("/:id/users/:userID", roleCtrl.RevokeRole)
+	}
+
+	permissionRoutes := r.Group("/permissions")
+	permissionRoutes.Use(authenticator.JWTAuth(), middleware.HasPermission("manage_users"))
+	{
+		permissionRoutes.GET("/", permissionCtrl.GetPermissions)
+		permissionRoutes.POST("/", permissionCtrl.CreatePermission)
+		permissionRoutes.DELETE("/:id", permissionCtrl.DeletePermission)
+	}
+
+	auditRoutes := r.Group("/audit-logs")
+	auditRoutes.Use(authenticator.JWTAuth(), middleware.HasPermission("manage_users"))
+	{
+		auditRoutes.GET("/", auditCtrl.GetAuditLogs)
+	}
+}
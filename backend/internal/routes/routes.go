@@ -1,19 +1,64 @@
 package routes
 
 import (
+	"log"
+	"time"
 	"github.com/gin-gonic/gin"
+	"digital-library/backend/internal/apikeys"
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/mfa"
+	"digital-library/backend/internal/middleware"
+	"digital-library/backend/internal/tokens"
 	"digital-library/backend/pkg/email"
 	"gorm.io/gorm"
 )
 
+// permissionCacheTTL bounds how long a user's resolved permissions are reused
+// before they are read from the database again.
+const permissionCacheTTL = 5 * time.Minute
+
+// Access tokens are short-lived; clients renew them with a refresh token.
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
 func SetupRoutes(db *gorm.DB, emailService *email.Service) *gin.Engine {
 	r := gin.Default()
 
+	authzService := authz.NewService(db, permissionCacheTTL)
+	tokenService := tokens.NewService(db, tokens.Config{
+		AccessTTL:  accessTokenTTL,
+		RefreshTTL: refreshTokenTTL,
+	})
+	mfaService := mfa.NewService(db, mfa.Config{
+		Issuer:              "Digital Library",
+		RequiredPermissions: mfaRequiredPermissions(),
+	})
+	apiKeyService := apikeys.NewService(db, authzService)
+	authenticator := middleware.NewAuthenticator(db, authzService, tokenService, mfaService, apiKeyService)
+
+	passwordPolicy := passwordPolicyFromEnv(db)
+
+	// Accounts created before library cards existed get one now
+	cardService := libraryCardsFromEnv(db)
+	if assigned, err := cardService.Backfill(); err != nil {
+		log.Printf("Failed to assign library cards: %v", err)
+	} else if assigned > 0 {
+		log.Printf("Assigned library cards to %d existing users", assigned)
+	}
+
 	// Setup auth routes with email service
-	SetupAuthRoutes(r, db, emailService)
+	SetupAuthRoutes(r, db, emailService, tokenService, mfaService, apiKeyService, passwordPolicy, cardService, authenticatorsFromEnv(db, authzService, cardService), authenticator)
+	SetupProfileRoutes(r, db, tokenService, passwordPolicy, authzService, authenticator)
+	SetupUserRoutes(r, db, emailService, tokenService, authzService, cardService, authenticator)
 	
 	// Setup other routes without email service
-	SetupBookRoutes(r, db)
-	SetupLoanRoutes(r, db)
+	SetupBookRoutes(r, db, searchEngineFromEnv(db), authenticator)
+	SetupCategoryRoutes(r, db, authenticator)
+	SetupCopyRoutes(r, db, authenticator)
+	SetupLoanRoutes(r, db, authenticator)
+	SetupRoleRoutes(r, db, authzService, authenticator)
+	SetupSSORoutes(r, ssoFromEnv(db, authzService, cardService), tokenService, mfaService, authenticator)
 	return r
-}
\ No newline at end of file
+}
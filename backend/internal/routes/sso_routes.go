@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"digital-library/backend/internal/controllers"
+	"digital-library/backend/internal/mfa"
+	"digital-library/backend/internal/middleware"
+	"digital-library/backend/internal/sso"
+	"digital-library/backend/internal/tokens"
+	"github.com/gin-gonic/gin"
+)
+
+func SetupSSORoutes(r *gin.Engine, ssoService *sso.Service, tokenService *tokens.Service, mfaService *mfa.Service, authenticator *middleware.Authenticator) {
+	ssoCtrl := &controllers.SSOController{
+		SSO:    ssoService,
+		Tokens: tokenService,
+		MFA:    mfaService,
+	}
+
+	oidcRoutes := r.Group("/auth/oidc")
+	{
+		oidcRoutes.GET("/login", ssoCtrl.Login)
+		oidcRoutes.GET("/callback", ssoCtrl.Callback)
+		// Accounts are only linked at the request of their signed-in owner,
+		// never through an API key
+		oidcRoutes.POST("/link", authenticator.JWTAuth(), middleware.RequireSession(), ssoCtrl.Link)
+	}
+}
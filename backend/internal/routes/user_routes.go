@@ -1,22 +1,47 @@
 package routes
 
 import (
+	"digital-library/backend/internal/authz"
 	"digital-library/backend/internal/controllers"
+	"digital-library/backend/internal/librarycard"
 	"digital-library/backend/internal/middleware"
+	"digital-library/backend/internal/onetime"
+	"digital-library/backend/internal/tokens"
+	"digital-library/backend/pkg/email"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func SetupUserRoutes(r *gin.Engine, db *gorm.DB) {
-	userCtrl := &controllers.UserController{DB: db}
+func SetupUserRoutes(r *gin.Engine, db *gorm.DB, emailService *email.Service, tokenService *tokens.Service, authzService *authz.Service, cardService *librarycard.Service, authenticator *middleware.Authenticator) {
+	userCtrl := &controllers.UserController{
+		DB:            db,
+		Email:         emailService,
+		Tokens:        tokenService,
+		OneTimeTokens: onetime.NewService(db),
+		Authz:         authzService,
+		Cards:         cardService,
+	}
 	
-	// All user routes require JWT
+	// All user routes require JWT and the manage_users permission
 	userRoutes := r.Group("/users")
-	userRoutes.Use(middleware.JWTAuth())
+	userRoutes.Use(authenticator.JWTAuth(), middleware.HasPermission("manage_users"))
 	{	
 		userRoutes.GET("/", userCtrl.GetUsers)
 		userRoutes.GET("/:id", userCtrl.GetUser)
-		userRoutes.PUT("/:id", middleware.HasPermission("edit_user"), userCtrl.UpdateUser)
-		userRoutes.DELETE("/:id", middleware.HasPermission("delete_user"), userCtrl.DeleteUser)
+		userRoutes.PUT("/:id", userCtrl.UpdateUser)
+		userRoutes.PATCH("/:id", userCtrl.UpdateUser)
+		userRoutes.DELETE("/:id", userCtrl.DeleteUser)
+		userRoutes.PUT("/:id/status", userCtrl.SetUserStatus)
+		userRoutes.POST("/:id/force-password-reset", userCtrl.ForcePasswordReset)
+		userRoutes.POST("/:id/verify-email", userCtrl.VerifyUserEmail)
+		userRoutes.GET("/:id/card/barcode", userCtrl.GetUserCardBarcode)
+		userRoutes.POST("/:id/card", userCtrl.ReissueCard)
+	}
+
+	// Desk staff scan a patron's card to start a checkout
+	cardRoutes := r.Group("/cards")
+	cardRoutes.Use(authenticator.JWTAuth(), middleware.HasAnyPermission("lookup_patrons", "manage_users"))
+	{
+		cardRoutes.GET("/:number", userCtrl.LookupCard)
 	}
 }
\ No newline at end of file
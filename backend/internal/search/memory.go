@@ -0,0 +1,403 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"digital-library/backend/internal/models"
+)
+
+// BM25 parameters: k1 limits how much repeating a word adds, b how much
+// long fields are penalised.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Indexed fields and how much a match in each counts, mirroring the
+// title-over-author-over-description weights of the Postgres engine.
+const (
+	fieldTitle = iota
+	fieldAuthor
+	fieldDescription
+	fieldCount
+)
+
+var fieldWeights = [fieldCount]float64{3, 2, 1}
+
+// snippetWords is how many words of the description a snippet shows.
+const snippetWords = 30
+
+// Memory is a search engine keeping an inverted index of the books in
+// process memory, scored with BM25. It needs no external service, which
+// suits tests and small deployments; the index is rebuilt on start and kept
+// current through Index and Remove.
+type Memory struct {
+	mu sync.RWMutex
+	// docs holds every indexed book by ID
+	docs map[uint]*document
+	// postings lists the books containing each stemmed word
+	postings map[string]map[uint]struct{}
+	// totalLength sums the number of words in each field over all books
+	totalLength [fieldCount]int
+}
+
+type document struct {
+	book   models.Book
+	fields [fieldCount]field
+}
+
+// field is the stemmed words of one field, in order, and how often each occurs
+type field struct {
+	tokens []string
+	freq   map[string]int
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		docs:     map[uint]*document{},
+		postings: map[string]map[uint]struct{}{},
+	}
+}
+
+// tokenize splits text into stemmed words.
+func tokenize(text string) []string {
+	words := Words(text)
+	for i, word := range words {
+		words[i] = Stem(word)
+	}
+	return words
+}
+
+func (m *Memory) Index(book models.Book) error {
+	doc := &document{book: book}
+	for i, text := range [fieldCount]string{
+		fieldTitle:       book.Title,
+		fieldAuthor:      book.Author,
+		fieldDescription: book.Description,
+	} {
+		tokens := tokenize(text)
+		freq := make(map[string]int, len(tokens))
+		for _, token := range tokens {
+			freq[token]++
+		}
+		doc.fields[i] = field{tokens: tokens, freq: freq}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(book.ID)
+	m.docs[book.ID] = doc
+	for i, f := range doc.fields {
+		m.totalLength[i] += len(f.tokens)
+		for token := range f.freq {
+			if m.postings[token] == nil {
+				m.postings[token] = map[uint]struct{}{}
+			}
+			m.postings[token][book.ID] = struct{}{}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Remove(bookID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(bookID)
+	return nil
+}
+
+func (m *Memory) remove(bookID uint) {
+	doc, ok := m.docs[bookID]
+	if !ok {
+		return
+	}
+	for i, f := range doc.fields {
+		m.totalLength[i] -= len(f.tokens)
+		for token := range f.freq {
+			delete(m.postings[token], bookID)
+			if len(m.postings[token]) == 0 {
+				delete(m.postings, token)
+			}
+		}
+	}
+	delete(m.docs, bookID)
+}
+
+// matcher is a compiled query term: for each of its words, the indexed
+// words it matches
+type matcher struct {
+	term
+	expansions []map[string]bool
+}
+
+// compile resolves each query word to the indexed words it matches: its
+// stem, or for a prefix every indexed word starting with it.
+func (m *Memory) compile(t term) matcher {
+	compiled := matcher{term: t, expansions: make([]map[string]bool, len(t.Words))}
+	for i, word := range t.Words {
+		matches := map[string]bool{}
+		stem := Stem(word)
+		if t.Prefix && i == len(t.Words)-1 {
+			// A complete word may be longer than its stem: "borrowing*"
+			// should find "borrower", indexed as "borrow"
+			for token := range m.postings {
+				if strings.HasPrefix(token, word) || strings.HasPrefix(token, stem) {
+					matches[token] = true
+				}
+			}
+		} else if _, ok := m.postings[stem]; ok {
+			matches[stem] = true
+		}
+		compiled.expansions[i] = matches
+	}
+	return compiled
+}
+
+// candidates returns the books containing the matcher's first word.
+func (m *Memory) candidates(mt matcher) map[uint]struct{} {
+	ids := map[uint]struct{}{}
+	for token := range mt.expansions[0] {
+		for id := range m.postings[token] {
+			ids[id] = struct{}{}
+		}
+	}
+	return ids
+}
+
+// matches reports whether the document contains the matcher's words in
+// order in one of its fields.
+func (mt matcher) matches(doc *document) bool {
+	for _, f := range doc.fields {
+		for start := 0; start+len(mt.expansions) <= len(f.tokens); start++ {
+			found := true
+			for i, expansion := range mt.expansions {
+				if !expansion[f.tokens[start+i]] {
+					found = false
+					break
+				}
+			}
+			if found {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// score is the BM25 score of the document for the matcher's words, summed
+// over the weighted fields.
+func (m *Memory) score(doc *document, mt matcher) float64 {
+	n := float64(len(m.docs))
+	score := 0.0
+	for _, expansion := range mt.expansions {
+		for token := range expansion {
+			containing := float64(len(m.postings[token]))
+			idf := math.Log(1 + (n-containing+0.5)/(containing+0.5))
+			for i, f := range doc.fields {
+				tf := float64(f.freq[token])
+				if tf == 0 {
+					continue
+				}
+				average := float64(m.totalLength[i]) / n
+				norm := 1 - bm25B + bm25B*float64(len(f.tokens))/average
+				score += fieldWeights[i] * idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+			}
+		}
+	}
+	return score
+}
+
+func (m *Memory) Search(q Query) (*Results, error) {
+	terms := parse(q.Text)
+	if len(terms) == 0 {
+		return &Results{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var required, excluded []matcher
+	for _, t := range terms {
+		if t.Negate {
+			excluded = append(excluded, m.compile(t))
+		} else {
+			required = append(required, m.compile(t))
+		}
+	}
+
+	type scored struct {
+		doc   *document
+		score float64
+	}
+	var matched []scored
+	for id := range m.candidates(required[0]) {
+		doc := m.docs[id]
+		if !matchesFilters(doc.book, q) {
+			continue
+		}
+		ok := true
+		for _, mt := range required {
+			ok = ok && mt.matches(doc)
+		}
+		for _, mt := range excluded {
+			ok = ok && !mt.matches(doc)
+		}
+		if !ok {
+			continue
+		}
+
+		score := 0.0
+		for _, mt := range required {
+			score += m.score(doc, mt)
+		}
+		matched = append(matched, scored{doc: doc, score: score})
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].score != matched[j].score {
+			return matched[i].score > matched[j].score
+		}
+		return matched[i].doc.book.ID < matched[j].doc.book.ID
+	})
+
+	books := make([]models.Book, len(matched))
+	for i, s := range matched {
+		books[i] = s.doc.book
+	}
+	results := &Results{Total: int64(len(matched)), Facets: countFacets(books)}
+
+	start := min(q.Offset, len(matched))
+	end := len(matched)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, end)
+	}
+	for _, s := range matched[start:end] {
+		results.Hits = append(results.Hits, Hit{
+			Book:  s.doc.book,
+			Score: s.score,
+			Match: MatchFullText,
+			Highlights: map[string]string{
+				"title":       highlight(markMatches(s.doc.book.Title, required, 0)),
+				"description": highlight(markMatches(s.doc.book.Description, required, snippetWords)),
+			},
+		})
+	}
+	return results, nil
+}
+
+func matchesFilters(book models.Book, q Query) bool {
+	return (q.Category == "" || strings.EqualFold(book.Category.Name, q.Category)) &&
+		(q.Author == "" || strings.EqualFold(book.Author, q.Author)) &&
+		(q.Status == "" || strings.EqualFold(book.Status, q.Status))
+}
+
+// countFacets counts the categories, authors and statuses of the books.
+func countFacets(books []models.Book) map[string][]FacetValue {
+	counts := map[string]map[string]int64{
+		FacetCategory: {},
+		FacetAuthor:   {},
+		FacetStatus:   {},
+	}
+	for _, book := range books {
+		if book.Category.Name != "" {
+			counts[FacetCategory][book.Category.Name]++
+		}
+		counts[FacetAuthor][book.Author]++
+		counts[FacetStatus][book.Status]++
+	}
+
+	facets := make(map[string][]FacetValue, len(counts))
+	for name, values := range counts {
+		list := make([]FacetValue, 0, len(values))
+		for value, count := range values {
+			list = append(list, FacetValue{Value: value, Count: count})
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Count != list[j].Count {
+				return list[i].Count > list[j].Count
+			}
+			return list[i].Value < list[j].Value
+		})
+		if len(list) > facetSize {
+			list = list[:facetSize]
+		}
+		facets[name] = list
+	}
+	return facets
+}
+
+// markMatches wraps the words of text matching any of the matchers in
+// highlight markers. With a word limit, only that many words are kept,
+// starting a little before the first match.
+func markMatches(text string, matchers []matcher, limit int) string {
+	// Split into alternating runs of word and non-word characters
+	var runs []string
+	var word []bool
+	for _, r := range text {
+		isWord := isWordRune(r)
+		if len(runs) == 0 || word[len(word)-1] != isWord {
+			runs = append(runs, "")
+			word = append(word, isWord)
+		}
+		runs[len(runs)-1] += string(r)
+	}
+
+	matched := make([]bool, len(runs))
+	first := -1
+	for i, run := range runs {
+		if !word[i] {
+			continue
+		}
+		token := Stem(strings.ToLower(run))
+		for _, mt := range matchers {
+			for _, expansion := range mt.expansions {
+				if expansion[token] {
+					matched[i] = true
+				}
+			}
+		}
+		if matched[i] && first < 0 {
+			first = i
+		}
+	}
+
+	from, to := 0, len(runs)
+	if limit > 0 {
+		words := 0
+		if first >= 0 {
+			// Start up to five words before the first match
+			for from = first; from > 0 && words < 5; from-- {
+				if word[from-1] {
+					words++
+				}
+			}
+		}
+		words = 0
+		for to = from; to < len(runs) && words < limit; to++ {
+			if word[to] {
+				words++
+			}
+		}
+	}
+
+	var out strings.Builder
+	if from > 0 {
+		out.WriteString("…")
+	}
+	for i := from; i < to; i++ {
+		if matched[i] {
+			out.WriteString(startMarker + runs[i] + stopMarker)
+		} else {
+			out.WriteString(runs[i])
+		}
+	}
+	if to < len(runs) {
+		out.WriteString("…")
+	}
+	return out.String()
+}
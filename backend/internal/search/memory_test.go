@@ -0,0 +1,164 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"digital-library/backend/internal/models"
+)
+
+func memoryWith(t *testing.T, books ...models.Book) *Memory {
+	t.Helper()
+	engine := NewMemory()
+	for i, book := range books {
+		book.ID = uint(i + 1)
+		if err := engine.Index(book); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return engine
+}
+
+func TestMemoryRanking(t *testing.T) {
+	tests := []struct {
+		name  string
+		books []models.Book
+		query string
+		want  []string
+	}{
+		{
+			name: "title outweighs author outweighs description",
+			books: []models.Book{
+				{Title: "Sea Stories", Description: "Tales about whales"},
+				{Title: "Ocean Life", Author: "Whale"},
+				{Title: "Whales"},
+			},
+			query: "whale",
+			want:  []string{"Whales", "Ocean Life", "Sea Stories"},
+		},
+		{
+			name: "repeated words count more",
+			books: []models.Book{
+				{Title: "One", Description: "a dragon and a knight in a tower"},
+				{Title: "Two", Description: "a dragon and a dragon in a tower"},
+			},
+			query: "dragon",
+			want:  []string{"Two", "One"},
+		},
+		{
+			name: "shorter fields count more",
+			books: []models.Book{
+				{Title: "Dragon tales from the northern kingdoms"},
+				{Title: "Dragon tales"},
+			},
+			query: "dragon tales",
+			want:  []string{"Dragon tales", "Dragon tales from the northern kingdoms"},
+		},
+		{
+			name: "rare words count more",
+			books: []models.Book{
+				{Title: "Common"},
+				{Title: "Common"},
+				{Title: "Common common rare"},
+				{Title: "Common rare rare"},
+			},
+			query: "rare common",
+			want:  []string{"Common rare rare", "Common common rare"},
+		},
+		{
+			name: "ties keep index order",
+			books: []models.Book{
+				{Title: "Dune"},
+				{Title: "Dune"},
+			},
+			query: "dune",
+			want:  []string{"Dune", "Dune"},
+		},
+		{
+			name: "stems match",
+			books: []models.Book{
+				{Title: "Borrowed time"},
+				{Title: "Time to borrow"},
+			},
+			query: "borrowing time",
+			want:  []string{"Borrowed time", "Time to borrow"},
+		},
+		{
+			name: "phrases match in order",
+			books: []models.Book{
+				{Title: "Time to borrow"},
+				{Title: "Borrowed time"},
+			},
+			query: `"borrowed time"`,
+			want:  []string{"Borrowed time"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectTitles(t, memoryWith(t, tt.books...), Query{Text: tt.query}, tt.want...)
+		})
+	}
+}
+
+func TestMemoryExclusions(t *testing.T) {
+	engine := memoryWith(t,
+		models.Book{Title: "The Hobbit", Description: "A dragon guards the gold"},
+		models.Book{Title: "The Fellowship of the Ring", Description: "The ring must be destroyed"},
+		models.Book{Title: "The Two Towers", Description: "The fellowship is broken"},
+	)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"the -dragon", []string{"The Fellowship of the Ring", "The Two Towers"}},
+		{"the -dragon -ring", []string{"The Two Towers"}},
+		{"the -drag*", []string{"The Fellowship of the Ring", "The Two Towers"}},
+		{"the -two-towers", []string{"The Fellowship of the Ring", "The Hobbit"}},
+		// Hyphenated words are phrases: these words are not adjacent
+		{"the -fellowship-ring", []string{"The Fellowship of the Ring", "The Hobbit", "The Two Towers"}},
+		{"-dragon", nil},
+		{"-dragon -ring", nil},
+	}
+	for _, tt := range tests {
+		expectTitles(t, engine, Query{Text: tt.query}, tt.want...)
+	}
+}
+
+func TestMemoryFacets(t *testing.T) {
+	fiction := models.Category{Name: "Fiction"}
+	engine := memoryWith(t,
+		models.Book{Title: "Dune", Author: "Herbert", Category: fiction, Status: models.BookAvailable},
+		models.Book{Title: "Dune Messiah", Author: "Herbert", Category: fiction, Status: models.BookCheckedOut},
+		models.Book{Title: "Dune: The Graphic Novel", Author: "Abnett", Status: models.BookAvailable},
+		models.Book{Title: "Foundation", Author: "Asimov", Category: fiction, Status: models.BookAvailable},
+	)
+
+	results, err := engine.Search(Query{Text: "dune"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]FacetValue{
+		// Books without a category are not counted
+		FacetCategory: {{Value: "Fiction", Count: 2}},
+		// Most common first, then by value
+		FacetAuthor: {{Value: "Herbert", Count: 2}, {Value: "Abnett", Count: 1}},
+		FacetStatus: {{Value: models.BookAvailable, Count: 2}, {Value: models.BookCheckedOut, Count: 1}},
+	}
+	if !reflect.DeepEqual(results.Facets, want) {
+		t.Errorf("facets = %+v, want %+v", results.Facets, want)
+	}
+
+	// Facets count every match, not just the page
+	results, err = engine.Search(Query{Text: "dune", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Hits) != 1 || results.Total != 3 || !reflect.DeepEqual(results.Facets, want) {
+		t.Errorf("page of 1: %d hits of %d, facets %+v; want 1 of 3 with all facets", len(results.Hits), results.Total, results.Facets)
+	}
+
+	// Facet values narrow the results, case-insensitively
+	expectTitles(t, engine, Query{Text: "dune", Author: "herbert", Status: models.BookAvailable}, "Dune")
+	expectTitles(t, engine, Query{Text: "dune", Category: "fiction"}, "Dune", "Dune Messiah")
+}
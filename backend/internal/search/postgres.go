@@ -0,0 +1,216 @@
+package search
+
+import (
+	"strings"
+
+	"digital-library/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// textSearchConfig is the Postgres text search configuration the books'
+// search_vector column is built with; queries must use the same one.
+const textSearchConfig = "english"
+
+// Postgres searches books with the database's full-text search: the
+// weighted search_vector column (title over author over description) ranks
+// matches, and when nothing matches, trigram similarity on title and author
+// finds books despite typos. Postgres maintains search_vector itself, so
+// Index and Remove do nothing.
+type Postgres struct {
+	db *gorm.DB
+}
+
+func NewPostgres(db *gorm.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+// row is a ranked match before its book is loaded
+type row struct {
+	ID             uint
+	Score          float64
+	TitleHighlight string
+	Snippet        string
+}
+
+func (p *Postgres) Search(q Query) (*Results, error) {
+	terms := parse(q.Text)
+	if len(terms) == 0 {
+		return &Results{}, nil
+	}
+
+	results, err := p.fullText(tsQuery(terms), q)
+	if err != nil || results.Total > 0 {
+		return results, err
+	}
+	return p.fuzzy(terms, q)
+}
+
+func (p *Postgres) Index(book models.Book) error { return nil }
+
+func (p *Postgres) Remove(bookID uint) error { return nil }
+
+func (p *Postgres) fullText(tsquery string, q Query) (*Results, error) {
+	matching := p.filtered(q).
+		Where("search_vector @@ to_tsquery(?, ?)", textSearchConfig, tsquery).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := matching.Count(&total).Error; err != nil || total == 0 {
+		return &Results{Total: total}, err
+	}
+
+	options := "StartSel=" + startMarker + ", StopSel=" + stopMarker
+	var rows []row
+	err := matching.
+		Select(`books.id,
+			ts_rank_cd(search_vector, to_tsquery(@config, @query)) AS score,
+			ts_headline(@config, title, to_tsquery(@config, @query), @title_options) AS title_highlight,
+			ts_headline(@config, description, to_tsquery(@config, @query), @snippet_options) AS snippet`,
+			map[string]interface{}{
+				"config":          textSearchConfig,
+				"query":           tsquery,
+				"title_options":   options + ", HighlightAll=true",
+				"snippet_options": options + ", MaxFragments=2, MaxWords=30, MinWords=10",
+			}).
+		Order("score DESC, books.id").
+		Limit(q.Limit).Offset(q.Offset).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return p.results(matching, rows, total, MatchFullText)
+}
+
+// fuzzy matches the query's words against titles and authors by trigram
+// word similarity, using pg_trgm's default threshold.
+func (p *Postgres) fuzzy(terms []term, q Query) (*Results, error) {
+	var words []string
+	for _, t := range terms {
+		if !t.Negate {
+			words = append(words, t.Words...)
+		}
+	}
+	text := strings.Join(words, " ")
+
+	matching := p.filtered(q).
+		Where("? <% title OR ? <% author", text, text).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := matching.Count(&total).Error; err != nil || total == 0 {
+		return &Results{Total: total}, err
+	}
+
+	var rows []row
+	err := matching.
+		Select(`books.id,
+			GREATEST(word_similarity(@text, title), word_similarity(@text, author)) AS score,
+			title AS title_highlight,
+			ts_headline(@config, description, plainto_tsquery(@config, @text), @options) AS snippet`,
+			map[string]interface{}{
+				"text":    text,
+				"config":  textSearchConfig,
+				"options": "StartSel=" + startMarker + ", StopSel=" + stopMarker + ", MaxFragments=1, MaxWords=30, MinWords=10",
+			}).
+		Order("score DESC, books.id").
+		Limit(q.Limit).Offset(q.Offset).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return p.results(matching, rows, total, MatchFuzzy)
+}
+
+// filtered starts a query for the books in the requested facet values
+func (p *Postgres) filtered(q Query) *gorm.DB {
+	query := p.db.Model(&models.Book{})
+	if q.Category != "" {
+		query = query.Where("books.category_id IN (SELECT id FROM categories WHERE LOWER(name) = LOWER(?) AND deleted_at IS NULL)", q.Category)
+	}
+	if q.Author != "" {
+		query = query.Where("LOWER(books.author) = LOWER(?)", q.Author)
+	}
+	if q.Status != "" {
+		query = query.Where("books.status = ?", strings.ToUpper(q.Status))
+	}
+	return query
+}
+
+// results loads the books of the ranked rows, keeping their order, and
+// counts the facets over every matching book
+func (p *Postgres) results(matching *gorm.DB, rows []row, total int64, match string) (*Results, error) {
+	ids := make([]uint, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.ID)
+	}
+	var books []models.Book
+	if err := p.db.Preload("Category").Where("id IN ?", ids).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Book, len(books))
+	for _, book := range books {
+		byID[book.ID] = book
+	}
+
+	hits := make([]Hit, 0, len(rows))
+	for _, r := range rows {
+		book, ok := byID[r.ID]
+		if !ok {
+			continue // deleted in the meantime
+		}
+		hits = append(hits, Hit{
+			Book:  book,
+			Score: r.Score,
+			Match: match,
+			Highlights: map[string]string{
+				"title":       highlight(r.TitleHighlight),
+				"description": highlight(r.Snippet),
+			},
+		})
+	}
+
+	facets := map[string][]FacetValue{}
+	for name, column := range map[string]string{
+		FacetCategory: "categories.name",
+		FacetAuthor:   "books.author",
+		FacetStatus:   "books.status",
+	} {
+		query := matching
+		if name == FacetCategory {
+			query = query.Joins("JOIN categories ON categories.id = books.category_id")
+		}
+		var values []FacetValue
+		err := query.
+			Select(column + " AS value, COUNT(*) AS count").
+			Group(column).
+			Order("count DESC, value").
+			Limit(facetSize).
+			Scan(&values).Error
+		if err != nil {
+			return nil, err
+		}
+		facets[name] = values
+	}
+
+	return &Results{Hits: hits, Total: total, Facets: facets}, nil
+}
+
+// tsQuery renders parsed terms as a to_tsquery expression; all terms must match.
+func tsQuery(terms []term) string {
+	parts := make([]string, 0, len(terms))
+	for _, t := range terms {
+		words := append([]string(nil), t.Words...)
+		if t.Prefix {
+			words[len(words)-1] += ":*"
+		}
+		part := strings.Join(words, " <-> ")
+		if len(words) > 1 {
+			part = "(" + part + ")"
+		}
+		if t.Negate {
+			part = "!" + part
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " & ")
+}
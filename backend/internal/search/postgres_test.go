@@ -0,0 +1,33 @@
+package search
+
+import "testing"
+
+func TestTsQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"words", "tolkien hobbit", "tolkien & hobbit:*"},
+		{"phrase", `"lord of the rings" tolkien`, "(lord <-> of <-> the <-> rings) & tolkien:*"},
+		{"phrase last", `tolkien "the rings"`, "tolkien & (the <-> rings)"},
+		{"exclusion", "hobbit -dragon", "hobbit & !dragon"},
+		{"excluded phrase", `hobbit -two-towers`, "hobbit & !(two <-> towers)"},
+		{"prefix", "hobb* ring", "hobb:* & ring:*"},
+		{"excluded prefix", "hobbit -drag*", "hobbit & !drag:*"},
+		{"hyphenated word", "science-fiction classics", "(science <-> fiction) & classics:*"},
+		{"hyphenated prefix", "science-fic*", "(science <-> fic:*)"},
+		{"query syntax is dropped", "hobbit & !(dragon | ring:*)", "hobbit & dragon & ring:*"},
+		{"quotes and backslashes are dropped", `o'brien \\ "x`, "(o <-> brien) & x"},
+		{"only exclusions", "-dragon -ring", ""},
+		{"only punctuation", `!!! -- "" * & | :*`, ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tsQuery(parse(tt.input)); got != tt.want {
+				t.Errorf("tsQuery(parse(%q)) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
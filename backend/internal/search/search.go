@@ -0,0 +1,138 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"digital-library/backend/internal/models"
+)
+
+// Engine finds books matching a text query. Implementations that keep their
+// own index are told about every change to a book; those that read from
+// the database directly may ignore Index and Remove.
+type Engine interface {
+	Search(q Query) (*Results, error)
+	// Index adds or replaces a book, with its Category loaded.
+	Index(book models.Book) error
+	Remove(bookID uint) error
+}
+
+// Match kinds of a hit
+const (
+	MatchFullText = "fulltext"
+	MatchFuzzy    = "fuzzy"
+)
+
+// Facets results can be counted and narrowed by
+const (
+	FacetCategory = "category"
+	FacetAuthor   = "author"
+	FacetStatus   = "status"
+)
+
+// facetSize is how many values of each facet are reported, most common first.
+const facetSize = 20
+
+// Query is a search request. Text supports "quoted phrases", -excluded
+// words, and a trailing * for prefix matching; the last word is always
+// matched as a prefix so results follow the user's typing. Category,
+// Author and Status, when set, narrow the results to that facet value.
+type Query struct {
+	Text     string
+	Category string
+	Author   string
+	Status   string
+	Limit    int
+	Offset   int
+}
+
+// Hit is a book matching a query.
+type Hit struct {
+	Book  models.Book
+	Score float64
+	Match string
+	// Highlights maps a field to its text with matches wrapped in <mark>;
+	// the rest of the text is HTML-escaped.
+	Highlights map[string]string
+}
+
+// FacetValue is a value of a facet and how many matching books have it.
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Results is one page of hits, the number of books matching overall, and
+// the facet counts over all of them.
+type Results struct {
+	Hits   []Hit
+	Total  int64
+	Facets map[string][]FacetValue
+}
+
+// term is one part of a parsed query: a single word, or a phrase or
+// hyphenated word whose words must appear in order.
+type term struct {
+	Words []string
+	// Prefix matches the last word as the start of a longer word
+	Prefix bool
+	Negate bool
+}
+
+// parse splits user input into terms. Words are reduced to letters and
+// digits so no input can form query syntax of its own. A query of only
+// exclusions would match nearly everything and yields no terms.
+func parse(text string) []term {
+	var terms []term
+	positive := false
+	remaining := strings.TrimSpace(text)
+	for remaining != "" {
+		var t term
+		if remaining[0] == '"' {
+			var phrase string
+			phrase, remaining, _ = strings.Cut(remaining[1:], `"`)
+			t.Words = Words(phrase)
+		} else {
+			var word string
+			word, remaining, _ = strings.Cut(remaining, " ")
+			t.Negate = strings.HasPrefix(word, "-")
+			t.Prefix = strings.HasSuffix(word, "*") || (!t.Negate && strings.TrimSpace(remaining) == "")
+			t.Words = Words(word)
+		}
+		if len(t.Words) > 0 {
+			terms = append(terms, t)
+			positive = positive || !t.Negate
+		}
+		remaining = strings.TrimSpace(remaining)
+	}
+
+	if !positive {
+		return nil
+	}
+	return terms
+}
+
+// Words splits text into lowercase words of letters and digits.
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !isWordRune(r)
+	})
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// Markers put around matches before the text is HTML-escaped. Control
+// characters cannot occur in book text, so they survive escaping unchanged.
+const (
+	startMarker = "\x02"
+	stopMarker  = "\x03"
+)
+
+// highlight escapes marked-up text for HTML and turns the match markers
+// into <mark> tags.
+func highlight(text string) string {
+	return strings.NewReplacer(startMarker, "<mark>", stopMarker, "</mark>").Replace(html.EscapeString(text))
+}
@@ -0,0 +1,69 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []term
+	}{
+		{"words", "Tolkien hobbit", []term{
+			{Words: []string{"tolkien"}},
+			{Words: []string{"hobbit"}, Prefix: true},
+		}},
+		{"phrase", `"Lord of the Rings" tolkien`, []term{
+			{Words: []string{"lord", "of", "the", "rings"}},
+			{Words: []string{"tolkien"}, Prefix: true},
+		}},
+		{"phrase last is not a prefix", `tolkien "the rings"`, []term{
+			{Words: []string{"tolkien"}},
+			{Words: []string{"the", "rings"}},
+		}},
+		{"unclosed phrase", `"the rings`, []term{
+			{Words: []string{"the", "rings"}},
+		}},
+		{"exclusion", "-dragon hobbit", []term{
+			{Words: []string{"dragon"}, Negate: true},
+			{Words: []string{"hobbit"}, Prefix: true},
+		}},
+		{"last exclusion is not a prefix", "hobbit -dragon", []term{
+			{Words: []string{"hobbit"}},
+			{Words: []string{"dragon"}, Negate: true},
+		}},
+		{"explicit prefix", "hobb* ring", []term{
+			{Words: []string{"hobb"}, Prefix: true},
+			{Words: []string{"ring"}, Prefix: true},
+		}},
+		{"excluded prefix", "-drag* hobbit", []term{
+			{Words: []string{"drag"}, Negate: true, Prefix: true},
+			{Words: []string{"hobbit"}, Prefix: true},
+		}},
+		{"hyphenated word", "science-fiction classics", []term{
+			{Words: []string{"science", "fiction"}},
+			{Words: []string{"classics"}, Prefix: true},
+		}},
+		{"extra spaces", "  hobbit   tolkien ", []term{
+			{Words: []string{"hobbit"}},
+			{Words: []string{"tolkien"}, Prefix: true},
+		}},
+		{"query syntax is dropped", "hobbit & !(dragon | ring:*)", []term{
+			{Words: []string{"hobbit"}},
+			{Words: []string{"dragon"}},
+			{Words: []string{"ring"}, Prefix: true},
+		}},
+		{"only exclusions", "-dragon -ring", nil},
+		{"only punctuation", `!!! -- "" *`, nil},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parse(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parse(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
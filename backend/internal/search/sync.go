@@ -0,0 +1,311 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"reflect"
+	"sync"
+
+	"digital-library/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// affectedKey is the statement setting holding the IDs an update or delete
+// is about to touch.
+const affectedKey = "search:affected"
+
+// Sync keeps the engine's index current. It indexes every book now, then
+// hooks into GORM's create, update and delete callbacks to note which books
+// each statement touches, directly or through the category they are filed
+// under. The noted books are read again and indexed once the statement's
+// transaction commits, so rolled back changes never reach the index and
+// deleted books are dropped from it.
+func Sync(db *gorm.DB, engine Engine) error {
+	s := &syncer{db: db, engine: engine, indexed: map[uint]bool{}}
+	if err := s.rebuild(); err != nil {
+		return err
+	}
+
+	// Wrap the connection pool to learn when transactions commit
+	pool := &syncPool{ConnPool: db.ConnPool, syncer: s}
+	db.ConnPool = pool
+	db.Statement.ConnPool = pool
+
+	callbacks := db.Callback()
+	if err := callbacks.Update().Before("gorm:update").Register(affectedKey, s.resolve); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register(affectedKey, s.resolve); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("gorm:create").Register("search:index", s.record); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("search:index", s.record); err != nil {
+		return err
+	}
+	return callbacks.Delete().After("gorm:delete").Register("search:index", s.record)
+}
+
+// changes are the books and categories a transaction touched. All asks for
+// the whole index to be rebuilt when the touched rows could not be told.
+type changes struct {
+	books      map[uint]bool
+	categories map[uint]bool
+	all        bool
+}
+
+func (c *changes) add(table string, ids []uint) {
+	target := &c.books
+	if table == "categories" {
+		target = &c.categories
+	}
+	if *target == nil {
+		*target = make(map[uint]bool, len(ids))
+	}
+	for _, id := range ids {
+		(*target)[id] = true
+	}
+}
+
+type syncer struct {
+	db     *gorm.DB
+	engine Engine
+	// mu serialises reading and indexing, so that a change read before a
+	// later commit cannot overwrite the state read after it
+	mu sync.Mutex
+	// indexed holds the IDs of the books in the index
+	indexed map[uint]bool
+}
+
+// resolve runs before an update or delete and notes the IDs of the rows it
+// will touch, looking them up by the statement's conditions when the model
+// carries none. Bulk statements may change the very columns they select
+// on, so the lookup cannot wait until after them.
+func (s *syncer) resolve(tx *gorm.DB) {
+	table := indexedTable(tx)
+	if table == "" {
+		return
+	}
+	ids := primaryKeys(tx)
+	if len(ids) == 0 {
+		where, ok := tx.Statement.Clauses["WHERE"]
+		if !ok {
+			return
+		}
+		model := reflect.New(tx.Statement.Schema.ModelType).Interface()
+		query := tx.Session(&gorm.Session{NewDB: true}).Model(model).Clauses(where.Expression)
+		if tx.Statement.Unscoped {
+			query = query.Unscoped()
+		}
+		if err := query.Pluck("id", &ids).Error; err != nil {
+			log.Printf("Failed to find the books a change touches, rebuilding the search index: %v", err)
+			return
+		}
+	}
+	tx.InstanceSet(affectedKey, ids)
+}
+
+// record notes the rows a statement touched on its transaction, to be
+// indexed once it commits, or indexes them now outside of a transaction.
+func (s *syncer) record(tx *gorm.DB) {
+	table := indexedTable(tx)
+	if table == "" {
+		return
+	}
+
+	c := &changes{}
+	t, inTransaction := tx.Statement.ConnPool.(*syncTx)
+	if inTransaction {
+		c = &t.changes
+	}
+	if ids, ok := tx.InstanceGet(affectedKey); ok {
+		c.add(table, ids.([]uint))
+	} else if ids := primaryKeys(tx); len(ids) > 0 {
+		c.add(table, ids)
+	} else {
+		c.all = true
+	}
+
+	if !inTransaction {
+		s.apply(c)
+	}
+}
+
+// apply re-reads the changed books and indexes them again, or removes them
+// if they no longer exist. Errors are logged: the change itself has been
+// committed and cannot be undone.
+func (s *syncer) apply(c *changes) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if c.all {
+		err = s.rebuild()
+	} else {
+		err = s.reindex(c)
+	}
+	if err != nil {
+		log.Printf("Failed to update search index: %v", err)
+	}
+}
+
+func (s *syncer) reindex(c *changes) error {
+	ids := mapKeys(c.books)
+	if len(c.categories) > 0 {
+		var filed []uint
+		if err := s.db.Model(&models.Book{}).Where("category_id IN ?", mapKeys(c.categories)).Pluck("id", &filed).Error; err != nil {
+			return err
+		}
+		ids = append(ids, filed...)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var books []models.Book
+	if err := s.db.Preload("Category").Where("id IN ?", ids).Find(&books).Error; err != nil {
+		return err
+	}
+	return s.replace(books, ids)
+}
+
+// rebuild indexes every book and drops any the index holds that are gone.
+func (s *syncer) rebuild() error {
+	var books []models.Book
+	if err := s.db.Preload("Category").Find(&books).Error; err != nil {
+		return err
+	}
+	return s.replace(books, mapKeys(s.indexed))
+}
+
+// replace indexes the books and removes those of the IDs not among them.
+func (s *syncer) replace(books []models.Book, ids []uint) error {
+	found := make(map[uint]bool, len(books))
+	for _, book := range books {
+		found[book.ID] = true
+		if err := s.engine.Index(book); err != nil {
+			return err
+		}
+		s.indexed[book.ID] = true
+	}
+	for _, id := range ids {
+		if found[id] || !s.indexed[id] {
+			continue
+		}
+		if err := s.engine.Remove(id); err != nil {
+			return err
+		}
+		delete(s.indexed, id)
+	}
+	return nil
+}
+
+// indexedTable returns the table of a successful statement if it can change
+// what is indexed, or "" otherwise.
+func indexedTable(tx *gorm.DB) string {
+	if tx.Error != nil || tx.Statement.Schema == nil {
+		return ""
+	}
+	switch table := tx.Statement.Schema.Table; table {
+	case "books", "categories":
+		return table
+	}
+	return ""
+}
+
+// primaryKeys returns the IDs of the records the statement's model or
+// destination holds.
+func primaryKeys(tx *gorm.DB) []uint {
+	field := tx.Statement.Schema.PrioritizedPrimaryField
+	if field == nil {
+		return nil
+	}
+
+	var ids []uint
+	collect := func(value reflect.Value) {
+		id, zero := field.ValueOf(tx.Statement.Context, value)
+		if zero {
+			return
+		}
+		if id, ok := id.(uint); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	value := reflect.Indirect(tx.Statement.ReflectValue)
+	switch value.Kind() {
+	case reflect.Struct:
+		collect(value)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			collect(reflect.Indirect(value.Index(i)))
+		}
+	}
+	return ids
+}
+
+func mapKeys(set map[uint]bool) []uint {
+	keys := make([]uint, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// syncPool is the database's connection pool, handing out transactions that
+// index their changes when they commit.
+type syncPool struct {
+	gorm.ConnPool
+	syncer *syncer
+}
+
+func (p *syncPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	var (
+		pool gorm.ConnPool
+		err  error
+	)
+	switch beginner := p.ConnPool.(type) {
+	case gorm.TxBeginner:
+		pool, err = beginner.BeginTx(ctx, opts)
+	case gorm.ConnPoolBeginner:
+		pool, err = beginner.BeginTx(ctx, opts)
+	default:
+		err = gorm.ErrInvalidTransaction
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &syncTx{ConnPool: pool, syncer: p.syncer}, nil
+}
+
+// GetDBConn lets gorm.DB.DB reach the wrapped *sql.DB.
+func (p *syncPool) GetDBConn() (*sql.DB, error) {
+	switch pool := p.ConnPool.(type) {
+	case *sql.DB:
+		return pool, nil
+	case gorm.GetDBConnector:
+		return pool.GetDBConn()
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+// syncTx is a transaction collecting the changes its statements make.
+type syncTx struct {
+	gorm.ConnPool
+	syncer  *syncer
+	changes changes
+}
+
+func (t *syncTx) Commit() error {
+	if err := t.ConnPool.(gorm.TxCommitter).Commit(); err != nil {
+		return err
+	}
+	t.syncer.apply(&t.changes)
+	return nil
+}
+
+func (t *syncTx) Rollback() error {
+	return t.ConnPool.(gorm.TxCommitter).Rollback()
+}
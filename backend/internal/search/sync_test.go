@@ -0,0 +1,151 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/testdb"
+	"gorm.io/gorm"
+)
+
+// syncFixture is a database with two categories, one book in each, kept in
+// sync with a Memory engine.
+func syncFixture(t *testing.T) (*gorm.DB, *Memory, []models.Category) {
+	t.Helper()
+	db := testdb.Open(t, &models.Category{}, &models.Book{})
+
+	categories := []models.Category{{Name: "Fiction"}, {Name: "History"}}
+	if err := db.Create(&categories).Error; err != nil {
+		t.Fatal(err)
+	}
+	books := []models.Book{
+		{Title: "The Hobbit", Author: "Tolkien", ISBN: "1", CategoryID: categories[0].ID},
+		{Title: "SPQR", Author: "Beard", ISBN: "2", CategoryID: categories[1].ID},
+	}
+	if err := db.Create(&books).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewMemory()
+	if err := Sync(db, engine); err != nil {
+		t.Fatal(err)
+	}
+	return db, engine, categories
+}
+
+// titles searches the engine and returns the titles found, best first.
+func titles(t *testing.T, engine Engine, q Query) []string {
+	t.Helper()
+	results, err := engine.Search(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := []string{}
+	for _, hit := range results.Hits {
+		found = append(found, hit.Book.Title)
+	}
+	return found
+}
+
+func expectTitles(t *testing.T, engine Engine, q Query, want ...string) {
+	t.Helper()
+	if want == nil {
+		want = []string{}
+	}
+	if got := titles(t, engine, q); !reflect.DeepEqual(got, want) {
+		t.Errorf("search %+v = %q, want %q", q, got, want)
+	}
+}
+
+func TestSyncIndexesExistingBooks(t *testing.T) {
+	_, engine, _ := syncFixture(t)
+	expectTitles(t, engine, Query{Text: "hobbit"}, "The Hobbit")
+	expectTitles(t, engine, Query{Text: "spqr", Category: "History"}, "SPQR")
+}
+
+func TestSyncCreateUpdateDelete(t *testing.T) {
+	db, engine, categories := syncFixture(t)
+
+	book := models.Book{Title: "Dune", Author: "Herbert", ISBN: "3", CategoryID: categories[0].ID}
+	if err := db.Create(&book).Error; err != nil {
+		t.Fatal(err)
+	}
+	expectTitles(t, engine, Query{Text: "dune"}, "Dune")
+
+	if err := db.Model(&book).Update("title", "Children of Dune").Error; err != nil {
+		t.Fatal(err)
+	}
+	expectTitles(t, engine, Query{Text: "children"}, "Children of Dune")
+
+	if err := db.Model(&book).Update("title", "Arrakis").Error; err != nil {
+		t.Fatal(err)
+	}
+	expectTitles(t, engine, Query{Text: "dune"})
+	expectTitles(t, engine, Query{Text: "arrakis"}, "Arrakis")
+
+	if err := db.Delete(&book).Error; err != nil {
+		t.Fatal(err)
+	}
+	expectTitles(t, engine, Query{Text: "arrakis"})
+}
+
+func TestSyncBulkStatements(t *testing.T) {
+	db, engine, categories := syncFixture(t)
+
+	// A merge moves books by their category, which the update changes
+	err := db.Unscoped().Model(&models.Book{}).Where("category_id = ?", categories[1].ID).Update("category_id", categories[0].ID).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectTitles(t, engine, Query{Text: "spqr", Category: "Fiction"}, "SPQR")
+	expectTitles(t, engine, Query{Text: "spqr", Category: "History"})
+
+	if err := db.Where("author = ?", "Tolkien").Delete(&models.Book{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	expectTitles(t, engine, Query{Text: "hobbit"})
+	expectTitles(t, engine, Query{Text: "spqr"}, "SPQR")
+}
+
+func TestSyncCategoryRename(t *testing.T) {
+	db, engine, categories := syncFixture(t)
+
+	if err := db.Model(&categories[1]).Update("name", "Ancient History").Error; err != nil {
+		t.Fatal(err)
+	}
+	expectTitles(t, engine, Query{Text: "spqr", Category: "Ancient History"}, "SPQR")
+}
+
+func TestSyncIndexesOnCommit(t *testing.T) {
+	db, engine, categories := syncFixture(t)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		book := models.Book{Title: "Dune", Author: "Herbert", ISBN: "3", CategoryID: categories[0].ID}
+		if err := tx.Create(&book).Error; err != nil {
+			return err
+		}
+		if got := titles(t, engine, Query{Text: "dune"}); len(got) != 0 {
+			t.Errorf("book indexed before commit: %q", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectTitles(t, engine, Query{Text: "dune"}, "Dune")
+
+	errRollback := errors.New("rollback")
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Book{}).Where("isbn = ?", "3").Update("title", "Arrakis").Error; err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("transaction = %v, want the rollback", err)
+	}
+	expectTitles(t, engine, Query{Text: "arrakis"})
+	expectTitles(t, engine, Query{Text: "dune"}, "Dune")
+}
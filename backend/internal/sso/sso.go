@@ -0,0 +1,279 @@
+package sso
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/provisioning"
+	"digital-library/backend/internal/utils"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrDisabled        = errors.New("single sign-on is not configured")
+	ErrInvalidState    = errors.New("invalid or expired login state")
+	ErrMissingEmail    = errors.New("identity provider did not return an email address")
+	ErrUnverifiedEmail = errors.New("identity provider has not verified the email address")
+)
+
+// StateTTL bounds how long a user may take at the identity provider.
+const StateTTL = 10 * time.Minute
+
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// GroupsClaim names the ID token claim listing the user's groups.
+	GroupsClaim string
+	// HTTPClient is used for discovery, token and key requests, e.g. to
+	// trust the certificate of a local stub IdP. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Enabled reports whether enough is configured to talk to a provider.
+func (c Config) Enabled() bool {
+	return c.IssuerURL != "" && c.ClientID != ""
+}
+
+// pendingLogin is what must survive the round trip through the provider.
+type pendingLogin struct {
+	nonce    string
+	verifier string
+	// browserKey is the hash of the secret given to the browser that
+	// started the flow, so no other browser can complete it
+	browserKey string
+	expires    time.Time
+	// linkUserID is the signed-in user who asked to link the provider
+	// account to theirs; zero for a login
+	linkUserID uint
+}
+
+// Service is an OpenID Connect relying party using the authorization code
+// flow with PKCE. Provider discovery happens on first use so the server can
+// start while the provider is unreachable.
+type Service struct {
+	config      Config
+	provisioner *provisioning.Service
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+	pending  map[string]pendingLogin
+}
+
+func NewService(cfg Config, provisioner *provisioning.Service) *Service {
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	return &Service{
+		config:      cfg,
+		provisioner: provisioner,
+		pending:     make(map[string]pendingLogin),
+	}
+}
+
+func (s *Service) context(ctx context.Context) context.Context {
+	if s.config.HTTPClient != nil {
+		return oidc.ClientContext(ctx, s.config.HTTPClient)
+	}
+	return ctx
+}
+
+func (s *Service) oauth2Config(ctx context.Context) (*oauth2.Config, *oidc.Provider, error) {
+	if !s.config.Enabled() {
+		return nil, nil, ErrDisabled
+	}
+
+	s.mu.Lock()
+	provider := s.provider
+	s.mu.Unlock()
+
+	if provider == nil {
+		var err error
+		provider, err = oidc.NewProvider(s.context(ctx), s.config.IssuerURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("discovering identity provider: %w", err)
+		}
+		s.mu.Lock()
+		s.provider = provider
+		s.mu.Unlock()
+	}
+
+	return &oauth2.Config{
+		ClientID:     s.config.ClientID,
+		ClientSecret: s.config.ClientSecret,
+		RedirectURL:  s.config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       s.config.Scopes,
+	}, provider, nil
+}
+
+// Authorization is a started login or link: the provider URL to send the
+// browser to, and a secret that browser must present at the callback. Keep
+// the secret where only that browser has it, e.g. in an HttpOnly cookie.
+type Authorization struct {
+	URL        string
+	BrowserKey string
+}
+
+// AuthorizationURL starts a login.
+func (s *Service) AuthorizationURL(ctx context.Context) (*Authorization, error) {
+	return s.authorize(ctx, 0)
+}
+
+// LinkURL starts linking a provider account to the signed-in user.
+func (s *Service) LinkURL(ctx context.Context, userID uint) (*Authorization, error) {
+	return s.authorize(ctx, userID)
+}
+
+func (s *Service) authorize(ctx context.Context, linkUserID uint) (*Authorization, error) {
+	oauthConfig, _, err := s.oauth2Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := utils.GenerateVerificationToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := utils.GenerateVerificationToken()
+	if err != nil {
+		return nil, err
+	}
+	browserKey, err := utils.GenerateVerificationToken()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	s.mu.Lock()
+	now := time.Now()
+	for key, p := range s.pending {
+		if now.After(p.expires) {
+			delete(s.pending, key)
+		}
+	}
+	s.pending[state] = pendingLogin{
+		nonce:      nonce,
+		verifier:   verifier,
+		browserKey: utils.HashToken(browserKey),
+		expires:    now.Add(StateTTL),
+		linkUserID: linkUserID,
+	}
+	s.mu.Unlock()
+
+	return &Authorization{
+		URL:        oauthConfig.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)),
+		BrowserKey: browserKey,
+	}, nil
+}
+
+// Result is the outcome of a completed callback.
+type Result struct {
+	// User is the provisioned library user of a login
+	User *models.User
+	// LinkedUserID is set instead when the provider account was linked to
+	// the user who asked for it
+	LinkedUserID uint
+}
+
+// Callback completes a login or link: it checks that the browser which
+// started it is the one finishing it, redeems the code, validates the ID
+// token, and then provisions the library user or links the provider
+// account to the user who started the link.
+func (s *Service) Callback(ctx context.Context, state, code, browserKey string) (*Result, error) {
+	s.mu.Lock()
+	pending, ok := s.pending[state]
+	delete(s.pending, state)
+	s.mu.Unlock()
+	if !ok || time.Now().After(pending.expires) {
+		return nil, ErrInvalidState
+	}
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(browserKey)), []byte(pending.browserKey)) != 1 {
+		return nil, ErrInvalidState
+	}
+
+	oauthConfig, provider, err := s.oauth2Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = s.context(ctx)
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(pending.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchanging authorization code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response did not include an id_token")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: s.config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verifying id_token: %w", err)
+	}
+	if idToken.Nonce != pending.nonce {
+		return nil, errors.New("id_token nonce does not match")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	ext := provisioning.ExternalUser{
+		Provider: idToken.Issuer,
+		Subject:  idToken.Subject,
+	}
+	ext.Email, _ = claims["email"].(string)
+	ext.Username, _ = claims["preferred_username"].(string)
+	ext.Groups = stringList(claims[s.config.GroupsClaim])
+
+	if pending.linkUserID != 0 {
+		if err := s.provisioner.Link(pending.linkUserID, ext); err != nil {
+			return nil, err
+		}
+		return &Result{LinkedUserID: pending.linkUserID}, nil
+	}
+
+	if ext.Email == "" {
+		return nil, ErrMissingEmail
+	}
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		return nil, ErrUnverifiedEmail
+	}
+	user, err := s.provisioner.Provision(ext)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{User: user}, nil
+}
+
+// stringList accepts a claim given either as a list or a single string.
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
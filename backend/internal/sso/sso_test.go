@@ -0,0 +1,472 @@
+package sso_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"digital-library/backend/internal/authz"
+	"digital-library/backend/internal/librarycard"
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/provisioning"
+	"digital-library/backend/internal/sso"
+	"digital-library/backend/internal/testdb"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const clientID = "library"
+
+// stubIdP is a minimal OpenID provider: discovery, JWKS and a token
+// endpoint that checks PKCE and returns whatever ID token claims the test
+// set up for the code.
+type stubIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+// grant is an authorization code the stub will redeem.
+type grant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &stubIdP{t: t, key: key, codes: map[string]grant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *stubIdP) issuer() string {
+	return idp.server.URL
+}
+
+func (idp *stubIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                idp.issuer(),
+		"authorization_endpoint":                idp.issuer() + "/authorize",
+		"token_endpoint":                        idp.issuer() + "/token",
+		"jwks_uri":                              idp.issuer() + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (idp *stubIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   encode(idp.key.N.Bytes()),
+			"e":   encode(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (idp *stubIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+		return
+	}
+
+	idp.mu.Lock()
+	g, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, g.claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Error(err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// authorize plays the user signing in at the provider: it reads the
+// authorization URL the relying party built and issues a code for it. The
+// ID token carries the request's nonce and the given claims, which may
+// override any standard claim.
+func (idp *stubIdP) authorize(authURL string, claims jwt.MapClaims) (state, code string) {
+	idp.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		idp.t.Fatalf("authorization URL lacks a PKCE challenge: %s", authURL)
+	}
+	if query.Get("client_id") != clientID {
+		idp.t.Fatalf("client_id = %q", query.Get("client_id"))
+	}
+
+	now := time.Now()
+	full := jwt.MapClaims{
+		"iss":   idp.issuer(),
+		"aud":   clientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Minute).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+
+	code = "code-" + query.Get("state")
+	idp.mu.Lock()
+	idp.codes[code] = grant{challenge: query.Get("code_challenge"), claims: full}
+	idp.mu.Unlock()
+	return query.Get("state"), code
+}
+
+type fixture struct {
+	idp *stubIdP
+	db  *gorm.DB
+	sso *sso.Service
+}
+
+func newFixture(t *testing.T) *fixture {
+	idp := newStubIdP(t)
+	db := testdb.Open(t, &models.User{}, &models.Role{}, &models.Permission{}, &models.ExternalIdentity{})
+	for _, name := range []string{"user", "staff", "admin"} {
+		if err := db.Create(&models.Role{Name: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mapping, err := provisioning.ParseRoleMapping("librarians=staff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provisioner := provisioning.NewService(db, authz.NewService(db, time.Minute),
+		librarycard.NewService(db, librarycard.Config{Prefix: "2"}),
+		provisioning.Config{Mapping: mapping, DefaultRole: "user"})
+
+	service := sso.NewService(sso.Config{
+		IssuerURL:   idp.issuer(),
+		ClientID:    clientID,
+		RedirectURL: "http://library.test/auth/oidc/callback",
+	}, provisioner)
+	return &fixture{idp: idp, db: db, sso: service}
+}
+
+// login runs a whole login with the given ID token claims.
+func (f *fixture) login(t *testing.T, claims jwt.MapClaims) (*sso.Result, error) {
+	t.Helper()
+	authorization, err := f.sso.AuthorizationURL(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := f.idp.authorize(authorization.URL, claims)
+	return f.sso.Callback(context.Background(), state, code, authorization.BrowserKey)
+}
+
+func roleNames(user *models.User) []string {
+	names := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		names = append(names, role.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func alice(groups ...interface{}) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":                "alice-sub",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+		"groups":             groups,
+	}
+}
+
+func TestLoginProvisionsUserWithMappedRoles(t *testing.T) {
+	f := newFixture(t)
+
+	result, err := f.login(t, alice("librarians"))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	user := result.User
+	if user == nil || user.Username != "alice" || user.Email != "alice@example.com" {
+		t.Fatalf("provisioned user = %+v", user)
+	}
+	if user.CardNumber == nil || !librarycard.Valid(*user.CardNumber) {
+		t.Errorf("provisioned user has no valid library card: %v", user.CardNumber)
+	}
+	if got := roleNames(user); len(got) != 1 || got[0] != "staff" {
+		t.Errorf("roles = %v, want [staff]", got)
+	}
+
+	var identity models.ExternalIdentity
+	if err := f.db.Where("provider = ? AND subject = ?", f.idp.issuer(), "alice-sub").First(&identity).Error; err != nil {
+		t.Fatalf("identity not recorded: %v", err)
+	}
+	if identity.UserID != user.ID {
+		t.Errorf("identity linked to user %d, want %d", identity.UserID, user.ID)
+	}
+
+	// Signing in again finds the same user; losing the group drops the
+	// mapped role and falls back to the default one
+	result, err = f.login(t, alice())
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if result.User.ID != user.ID {
+		t.Errorf("second login got user %d, want %d", result.User.ID, user.ID)
+	}
+	if got := roleNames(result.User); len(got) != 1 || got[0] != "user" {
+		t.Errorf("roles after leaving group = %v, want [user]", got)
+	}
+}
+
+func TestMappingLeavesUnmanagedRolesAlone(t *testing.T) {
+	f := newFixture(t)
+
+	result, err := f.login(t, alice("librarians"))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	var admin models.Role
+	f.db.Where("name = ?", "admin").First(&admin)
+	if err := f.db.Model(result.User).Association("Roles").Append(&admin); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = f.login(t, alice())
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if got := roleNames(result.User); len(got) != 1 || got[0] != "admin" {
+		t.Errorf("roles = %v, want [admin]", got)
+	}
+}
+
+func TestLoginNeverTakesOverLocalAccountByEmail(t *testing.T) {
+	f := newFixture(t)
+	local := models.User{Username: "admin", Email: "admin@library.com", Password: "hash", IsVerified: true}
+	if err := f.db.Create(&local).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := f.login(t, jwt.MapClaims{
+		"sub":            "attacker",
+		"email":          "ADMIN@library.com",
+		"email_verified": true,
+		"groups":         []interface{}{"librarians"},
+	})
+	if !errors.Is(err, provisioning.ErrEmailTaken) {
+		t.Fatalf("err = %v, want ErrEmailTaken", err)
+	}
+
+	var count int64
+	f.db.Model(&models.ExternalIdentity{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d identities linked, want none", count)
+	}
+}
+
+func TestLoginRequiresAVerifiedEmail(t *testing.T) {
+	for name, verified := range map[string]interface{}{"false": false, "missing": nil, "string": "true"} {
+		t.Run(name, func(t *testing.T) {
+			f := newFixture(t)
+			claims := alice()
+			if verified == nil {
+				delete(claims, "email_verified")
+			} else {
+				claims["email_verified"] = verified
+			}
+
+			if _, err := f.login(t, claims); !errors.Is(err, sso.ErrUnverifiedEmail) {
+				t.Fatalf("err = %v, want ErrUnverifiedEmail", err)
+			}
+			var count int64
+			f.db.Model(&models.User{}).Count(&count)
+			if count != 0 {
+				t.Errorf("%d users provisioned, want none", count)
+			}
+		})
+	}
+}
+
+func TestLinkAttachesIdentityToSignedInUser(t *testing.T) {
+	f := newFixture(t)
+	local := models.User{Username: "alice", Email: "alice@library.com", Password: "hash", IsVerified: true}
+	if err := f.db.Create(&local).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	authorization, err := f.sso.LinkURL(context.Background(), local.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := f.idp.authorize(authorization.URL, alice())
+	result, err := f.sso.Callback(context.Background(), state, code, authorization.BrowserKey)
+	if err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	if result.LinkedUserID != local.ID || result.User != nil {
+		t.Fatalf("result = %+v, want a link to user %d", result, local.ID)
+	}
+
+	// The provider now signs the local user in
+	login, err := f.login(t, alice())
+	if err != nil {
+		t.Fatalf("login after link: %v", err)
+	}
+	if login.User.ID != local.ID {
+		t.Errorf("login got user %d, want %d", login.User.ID, local.ID)
+	}
+
+	// Another user cannot claim the same provider account
+	other := models.User{Username: "bob", Email: "bob@library.com", Password: "hash"}
+	f.db.Create(&other)
+	authorization, _ = f.sso.LinkURL(context.Background(), other.ID)
+	state, code = f.idp.authorize(authorization.URL, alice())
+	if _, err := f.sso.Callback(context.Background(), state, code, authorization.BrowserKey); !errors.Is(err, provisioning.ErrIdentityLinked) {
+		t.Errorf("linking a taken identity: err = %v, want ErrIdentityLinked", err)
+	}
+}
+
+func TestCallbackRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{"wrong issuer", jwt.MapClaims{"iss": "https://evil.example.com"}},
+		{"wrong audience", jwt.MapClaims{"aud": "another-client"}},
+		{"wrong nonce", jwt.MapClaims{"nonce": "replayed"}},
+		{"expired", jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			claims := alice()
+			for k, v := range tt.claims {
+				claims[k] = v
+			}
+			if _, err := f.login(t, claims); err == nil {
+				t.Fatal("login succeeded")
+			}
+
+			var count int64
+			f.db.Model(&models.User{}).Count(&count)
+			if count != 0 {
+				t.Errorf("%d users provisioned, want none", count)
+			}
+		})
+	}
+}
+
+func TestCallbackRequiresMatchingPKCEVerifier(t *testing.T) {
+	f := newFixture(t)
+	authorization, err := f.sso.AuthorizationURL(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := f.idp.authorize(authorization.URL, alice())
+
+	// The code was issued for another challenge, as if intercepted and
+	// redeemed by a client without the verifier
+	f.idp.mu.Lock()
+	g := f.idp.codes[code]
+	g.challenge = "not-the-challenge"
+	f.idp.codes[code] = g
+	f.idp.mu.Unlock()
+
+	if _, err := f.sso.Callback(context.Background(), state, code, authorization.BrowserKey); err == nil {
+		t.Fatal("callback succeeded without a matching verifier")
+	}
+}
+
+func TestCallbackRejectsUnknownOrReusedState(t *testing.T) {
+	f := newFixture(t)
+	if _, err := f.sso.Callback(context.Background(), "made-up", "code", ""); !errors.Is(err, sso.ErrInvalidState) {
+		t.Errorf("unknown state: err = %v, want ErrInvalidState", err)
+	}
+
+	authorization, _ := f.sso.AuthorizationURL(context.Background())
+	state, code := f.idp.authorize(authorization.URL, alice())
+	if _, err := f.sso.Callback(context.Background(), state, code, authorization.BrowserKey); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if _, err := f.sso.Callback(context.Background(), state, code, authorization.BrowserKey); !errors.Is(err, sso.ErrInvalidState) {
+		t.Errorf("reused state: err = %v, want ErrInvalidState", err)
+	}
+}
+
+// A flow started in one browser cannot be finished in another, e.g. by an
+// attacker luring a victim to the callback of the attacker's own login
+func TestCallbackRequiresTheStartingBrowser(t *testing.T) {
+	f := newFixture(t)
+	local := models.User{Username: "victim", Email: "victim@library.com", Password: "hash"}
+	if err := f.db.Create(&local).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for name, start := range map[string]func() (*sso.Authorization, error){
+		"login": func() (*sso.Authorization, error) { return f.sso.AuthorizationURL(context.Background()) },
+		"link":  func() (*sso.Authorization, error) { return f.sso.LinkURL(context.Background(), local.ID) },
+	} {
+		for _, browserKey := range []string{"", "another-browser"} {
+			authorization, err := start()
+			if err != nil {
+				t.Fatal(err)
+			}
+			state, code := f.idp.authorize(authorization.URL, alice())
+			if _, err := f.sso.Callback(context.Background(), state, code, browserKey); !errors.Is(err, sso.ErrInvalidState) {
+				t.Errorf("%s with browser key %q: err = %v, want ErrInvalidState", name, browserKey, err)
+			}
+		}
+	}
+
+	var identities int64
+	f.db.Model(&models.ExternalIdentity{}).Count(&identities)
+	if identities != 0 {
+		t.Errorf("%d identities linked or provisioned, want none", identities)
+	}
+}
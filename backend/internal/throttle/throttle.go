@@ -0,0 +1,181 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Record is the failure history tracked for one key, e.g. a username or IP.
+type Record struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store persists failure records. MemoryStore is the default; a shared store
+// is needed when running more than one server instance.
+type Store interface {
+	Get(key string) (Record, bool, error)
+	Put(key string, record Record, ttl time.Duration) error
+	Delete(key string) error
+}
+
+type Config struct {
+	// MaxFailures locks the key once reached; zero disables locking.
+	MaxFailures int
+	// LockoutDuration is how long a key stays locked.
+	LockoutDuration time.Duration
+	// BaseDelay is the wait imposed after the first failure; it doubles with
+	// every further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long failures are remembered after the most recent one.
+	Window time.Duration
+}
+
+// Status is the outcome of checking a key before an attempt.
+type Status struct {
+	Locked     bool
+	RetryAfter time.Duration // zero when an attempt is allowed now
+}
+
+// Allowed reports whether an attempt may be made now.
+func (s Status) Allowed() bool {
+	return !s.Locked && s.RetryAfter <= 0
+}
+
+// Limiter applies exponential backoff and temporary lockout to repeated failures.
+type Limiter struct {
+	store  Store
+	config Config
+	now    func() time.Time
+}
+
+func NewLimiter(store Store, cfg Config) *Limiter {
+	return &Limiter{store: store, config: cfg, now: time.Now}
+}
+
+// Check reports whether an attempt for the key is currently allowed.
+func (l *Limiter) Check(key string) (Status, error) {
+	record, ok, err := l.store.Get(key)
+	if err != nil || !ok {
+		return Status{}, err
+	}
+
+	now := l.now()
+	if now.Before(record.LockedUntil) {
+		return Status{Locked: true, RetryAfter: record.LockedUntil.Sub(now)}, nil
+	}
+
+	next := record.LastFailure.Add(l.delay(record.Failures))
+	if now.Before(next) {
+		return Status{RetryAfter: next.Sub(now)}, nil
+	}
+	return Status{}, nil
+}
+
+// Fail records a failed attempt. It returns the updated record and whether
+// this failure caused the key to become locked.
+func (l *Limiter) Fail(key string) (Record, bool, error) {
+	record, _, err := l.store.Get(key)
+	if err != nil {
+		return Record{}, false, err
+	}
+
+	now := l.now()
+	if !record.LockedUntil.IsZero() && !now.Before(record.LockedUntil) {
+		// A lockout that has run out starts the count afresh.
+		record = Record{}
+	}
+
+	record.Failures++
+	record.LastFailure = now
+
+	locked := false
+	if l.config.MaxFailures > 0 && record.Failures >= l.config.MaxFailures && !now.Before(record.LockedUntil) {
+		record.LockedUntil = now.Add(l.config.LockoutDuration)
+		locked = true
+	}
+
+	ttl := l.config.Window
+	if remaining := record.LockedUntil.Sub(now); remaining > ttl {
+		ttl = remaining
+	}
+	return record, locked, l.store.Put(key, record, ttl)
+}
+
+// Reset clears the failure history of the key, e.g. after a successful login
+// or when an administrator unlocks an account.
+func (l *Limiter) Reset(key string) error {
+	return l.store.Delete(key)
+}
+
+func (l *Limiter) delay(failures int) time.Duration {
+	if failures <= 0 || l.config.BaseDelay <= 0 {
+		return 0
+	}
+	delay := l.config.BaseDelay
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if delay >= l.config.MaxDelay {
+			return l.config.MaxDelay
+		}
+	}
+	return delay
+}
+
+type memoryEntry struct {
+	record  Record
+	expires time.Time
+}
+
+// pruneInterval is how often MemoryStore sweeps expired entries.
+const pruneInterval = time.Minute
+
+// MemoryStore keeps records in process memory. Expired entries are pruned
+// periodically on write.
+type MemoryStore struct {
+	mu         sync.Mutex
+	entries    map[string]memoryEntry
+	lastPruned time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+func (m *MemoryStore) Get(key string) (Record, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return Record{}, false, nil
+	}
+	return entry.record, true, nil
+}
+
+func (m *MemoryStore) Put(key string, record Record, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastPruned) > pruneInterval {
+		for k, entry := range m.entries {
+			if now.After(entry.expires) {
+				delete(m.entries, k)
+			}
+		}
+		m.lastPruned = now
+	}
+	m.entries[key] = memoryEntry{record: record, expires: now.Add(ttl)}
+	return nil
+}
+
+func (m *MemoryStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
@@ -0,0 +1,141 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+// clock is a time source the tests move by hand.
+type clock struct{ now time.Time }
+
+func (c *clock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newLimiter(cfg Config) (*Limiter, *clock) {
+	c := &clock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewLimiter(NewMemoryStore(), cfg)
+	l.now = func() time.Time { return c.now }
+	return l, c
+}
+
+func check(t *testing.T, l *Limiter, key string) Status {
+	t.Helper()
+	status, err := l.Check(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func fail(t *testing.T, l *Limiter, key string) bool {
+	t.Helper()
+	_, locked, err := l.Fail(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return locked
+}
+
+func TestBackoffDoublesUpToTheMaximum(t *testing.T) {
+	l, c := newLimiter(Config{BaseDelay: time.Second, MaxDelay: 5 * time.Second, Window: time.Hour})
+
+	if status := check(t, l, "alice"); !status.Allowed() {
+		t.Fatalf("first attempt not allowed: %+v", status)
+	}
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		fail(t, l, "alice")
+		status := check(t, l, "alice")
+		if status.Allowed() || status.Locked || status.RetryAfter != want {
+			t.Fatalf("after failure %d: status = %+v, want retry after %v", i+1, status, want)
+		}
+		c.advance(want)
+		if status := check(t, l, "alice"); !status.Allowed() {
+			t.Fatalf("after waiting %v: status = %+v, want allowed", want, status)
+		}
+	}
+
+	if status := check(t, l, "bob"); !status.Allowed() {
+		t.Errorf("other key throttled: %+v", status)
+	}
+}
+
+func TestLockoutAfterMaxFailures(t *testing.T) {
+	l, c := newLimiter(Config{MaxFailures: 3, LockoutDuration: 15 * time.Minute, Window: time.Hour})
+
+	for i := 1; i <= 3; i++ {
+		if locked := fail(t, l, "alice"); locked != (i == 3) {
+			t.Fatalf("failure %d: locked = %v", i, locked)
+		}
+	}
+	status := check(t, l, "alice")
+	if !status.Locked || status.RetryAfter != 15*time.Minute {
+		t.Fatalf("status = %+v, want locked for 15m", status)
+	}
+
+	// Failing while locked does not extend the lockout
+	c.advance(10 * time.Minute)
+	if locked := fail(t, l, "alice"); locked {
+		t.Error("failure while locked locked again")
+	}
+	if status := check(t, l, "alice"); status.RetryAfter != 5*time.Minute {
+		t.Errorf("status = %+v, want 5m left", status)
+	}
+
+	// Once the lockout runs out, the count starts afresh
+	c.advance(5 * time.Minute)
+	if status := check(t, l, "alice"); !status.Allowed() {
+		t.Fatalf("status = %+v, want allowed after the lockout", status)
+	}
+	if locked := fail(t, l, "alice"); locked {
+		t.Error("first failure after a lockout locked again")
+	}
+}
+
+func TestZeroMaxFailuresNeverLocks(t *testing.T) {
+	l, _ := newLimiter(Config{LockoutDuration: time.Minute, Window: time.Hour})
+	for i := 0; i < 100; i++ {
+		if fail(t, l, "alice") {
+			t.Fatalf("locked after %d failures", i+1)
+		}
+	}
+	if status := check(t, l, "alice"); !status.Allowed() {
+		t.Errorf("status = %+v, want allowed", status)
+	}
+}
+
+func TestResetClearsFailures(t *testing.T) {
+	l, _ := newLimiter(Config{MaxFailures: 2, LockoutDuration: time.Minute, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour})
+	fail(t, l, "alice")
+	fail(t, l, "alice")
+	if status := check(t, l, "alice"); !status.Locked {
+		t.Fatalf("status = %+v, want locked", status)
+	}
+
+	if err := l.Reset("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if status := check(t, l, "alice"); !status.Allowed() {
+		t.Errorf("status = %+v, want allowed after reset", status)
+	}
+	record, _, err := l.Fail("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Failures != 1 {
+		t.Errorf("failures after reset = %d, want 1", record.Failures)
+	}
+}
+
+func TestMemoryStoreForgetsAfterTheWindow(t *testing.T) {
+	store := NewMemoryStore()
+	if err := store.Put("alice", Record{Failures: 2}, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if record, ok, _ := store.Get("alice"); !ok || record.Failures != 2 {
+		t.Fatalf("get = %+v, %v; want the record", record, ok)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if _, ok, _ := store.Get("alice"); ok {
+		t.Error("record still present after its window")
+	}
+}
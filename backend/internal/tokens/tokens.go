@@ -0,0 +1,289 @@
+package tokens
+
+import (
+	"errors"
+	"time"
+
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidToken is returned for unknown, expired or revoked refresh tokens.
+	ErrInvalidToken = errors.New("invalid or expired refresh token")
+	// ErrTokenReuse is returned when an already-rotated refresh token is
+	// presented again; the whole session is revoked when this happens.
+	ErrTokenReuse = errors.New("refresh token reuse detected")
+	// ErrSessionNotFound is returned when revoking a session the user does not own.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrAccountDeactivated is returned when starting or renewing a session
+	// for an account that may not sign in.
+	ErrAccountDeactivated = errors.New("account is deactivated")
+)
+
+// lastSeenInterval limits how often a session's LastSeenAt is written.
+const lastSeenInterval = time.Minute
+
+type Config struct {
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// Pair is the credential set returned to a client after login or refresh.
+type Pair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // access token lifetime in seconds
+}
+
+// Client describes the device a session was started from.
+type Client struct {
+	UserAgent string
+	IPAddress string
+}
+
+// Service issues short-lived access tokens together with persisted,
+// rotating refresh tokens, and tracks the login sessions they belong to.
+type Service struct {
+	db     *gorm.DB
+	config Config
+}
+
+func NewService(db *gorm.DB, cfg Config) *Service {
+	return &Service{db: db, config: cfg}
+}
+
+// Issue starts a new session for the user, e.g. after a successful login.
+func (s *Service) Issue(user models.User, client Client) (*Pair, error) {
+	if !user.CanSignIn() {
+		return nil, ErrAccountDeactivated
+	}
+
+	var pair *Pair
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		session := models.Session{
+			UserID:     user.ID,
+			UserAgent:  client.UserAgent,
+			IPAddress:  client.IPAddress,
+			LastSeenAt: now,
+			ExpiresAt:  now.Add(s.config.RefreshTTL),
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		refresh, _, err := s.createRefreshToken(tx, session)
+		if err != nil {
+			return err
+		}
+
+		pair, err = s.pair(user, session.ID, refresh)
+		return err
+	})
+
+	return pair, err
+}
+
+// Rotate exchanges a refresh token for a new pair in the same session. The
+// presented token is revoked; presenting it again revokes the session.
+func (s *Service) Rotate(refreshToken string) (*Pair, error) {
+	var pair *Pair
+	var reusedSession uint
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		if err := tx.Where("token_hash = ?", utils.HashToken(refreshToken)).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidToken
+			}
+			return err
+		}
+
+		if current.RevokedAt != nil {
+			if current.ReplacedBy != nil {
+				reusedSession = current.SessionID
+				return ErrTokenReuse
+			}
+			return ErrInvalidToken
+		}
+		if time.Now().After(current.ExpiresAt) {
+			return ErrInvalidToken
+		}
+
+		var session models.Session
+		if err := tx.First(&session, current.SessionID).Error; err != nil || session.RevokedAt != nil {
+			return ErrInvalidToken
+		}
+
+		var user models.User
+		if err := tx.Preload("Roles").First(&user, current.UserID).Error; err != nil {
+			return ErrInvalidToken
+		}
+		if !user.CanSignIn() {
+			return ErrAccountDeactivated
+		}
+
+		refresh, next, err := s.createRefreshToken(tx, session)
+		if err != nil {
+			return err
+		}
+
+		// Revoke the token only if it is still live: of two requests racing
+		// with the same token, the second finds it already rotated, which is
+		// reuse like any other
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Updates(map[string]interface{}{"revoked_at": now, "replaced_by": next.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reusedSession = current.SessionID
+			return ErrTokenReuse
+		}
+
+		err = tx.Model(&session).Updates(map[string]interface{}{
+			"last_seen_at": now,
+			"expires_at":   next.ExpiresAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		pair, err = s.pair(user, session.ID, refresh)
+		return err
+	})
+
+	// A rotated token came back: assume it was stolen and end the session.
+	// This runs outside the transaction, which is rolled back on error.
+	if errors.Is(err, ErrTokenReuse) {
+		if revokeErr := s.revokeSessions("id = ?", reusedSession); revokeErr != nil {
+			return nil, revokeErr
+		}
+	}
+
+	return pair, err
+}
+
+// Revoke ends the session the refresh token belongs to.
+func (s *Service) Revoke(refreshToken string) error {
+	var current models.RefreshToken
+	if err := s.db.Where("token_hash = ?", utils.HashToken(refreshToken)).First(&current).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+	return s.revokeSessions("id = ?", current.SessionID)
+}
+
+// RevokeSession ends one of the user's sessions.
+func (s *Service) RevokeSession(userID, sessionID uint) error {
+	var session models.Session
+	if err := s.db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+	return s.revokeSessions("id = ?", session.ID)
+}
+
+// RevokeAll ends every session of the user.
+func (s *Service) RevokeAll(userID uint) error {
+	return s.revokeSessions("user_id = ?", userID)
+}
+
+// RevokeOthers ends every session of the user except the given one, e.g.
+// after a password change made from that session.
+func (s *Service) RevokeOthers(userID, keepSessionID uint) error {
+	return s.revokeSessions("user_id = ? AND id <> ?", userID, keepSessionID)
+}
+
+// Sessions lists the user's sessions that are still usable, newest first.
+func (s *Service) Sessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := s.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// SessionActive reports whether the session is neither revoked nor expired.
+// Access tokens from inactive sessions are rejected by JWTAuth.
+func (s *Service) SessionActive(sessionID uint) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Touch records activity on the session, writing at most once per lastSeenInterval.
+func (s *Service) Touch(sessionID uint) error {
+	now := time.Now()
+	return s.db.Model(&models.Session{}).
+		Where("id = ? AND last_seen_at < ?", sessionID, now.Add(-lastSeenInterval)).
+		Update("last_seen_at", now).Error
+}
+
+// revokeSessions revokes the sessions matching the condition together with their refresh tokens.
+func (s *Service) revokeSessions(query string, args ...interface{}) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Model(&models.Session{}).Where(query, args...).Where("revoked_at IS NULL").Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.Session{}).Where("id IN ?", ids).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("session_id IN ? AND revoked_at IS NULL", ids).
+			Update("revoked_at", now).Error
+	})
+}
+
+func (s *Service) createRefreshToken(tx *gorm.DB, session models.Session) (string, models.RefreshToken, error) {
+	token, err := utils.GenerateVerificationToken()
+	if err != nil {
+		return "", models.RefreshToken{}, err
+	}
+
+	record := models.RefreshToken{
+		UserID:    session.UserID,
+		TokenHash: utils.HashToken(token),
+		SessionID: session.ID,
+		ExpiresAt: time.Now().Add(s.config.RefreshTTL),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return "", models.RefreshToken{}, err
+	}
+	return token, record, nil
+}
+
+func (s *Service) pair(user models.User, sessionID uint, refreshToken string) (*Pair, error) {
+	var roleNames []string
+	for _, role := range user.Roles {
+		roleNames = append(roleNames, role.Name)
+	}
+
+	accessToken, err := utils.GenerateJWT(user.ID, roleNames, sessionID, s.config.AccessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.config.AccessTTL.Seconds()),
+	}, nil
+}
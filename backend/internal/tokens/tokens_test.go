@@ -0,0 +1,186 @@
+package tokens_test
+
+import (
+	"errors"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"digital-library/backend/internal/models"
+	"digital-library/backend/internal/testdb"
+	"digital-library/backend/internal/tokens"
+	"digital-library/backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("JWT_DEV_KEY", "true")
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
+func newService(t *testing.T) (*tokens.Service, *gorm.DB, models.User) {
+	t.Helper()
+	db := testdb.Open(t, &models.User{}, &models.Role{}, &models.Permission{}, &models.Session{}, &models.RefreshToken{})
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "hash", Status: models.UserActive}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return tokens.NewService(db, tokens.Config{AccessTTL: time.Minute, RefreshTTL: time.Hour}), db, user
+}
+
+func issue(t *testing.T, s *tokens.Service, user models.User) *tokens.Pair {
+	t.Helper()
+	pair, err := s.Issue(user, tokens.Client{UserAgent: "test", IPAddress: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	return pair
+}
+
+func rotate(t *testing.T, s *tokens.Service, refreshToken string) *tokens.Pair {
+	t.Helper()
+	pair, err := s.Rotate(refreshToken)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	return pair
+}
+
+func TestRotateReplacesTheRefreshToken(t *testing.T) {
+	s, db, user := newService(t)
+	first := issue(t, s, user)
+	if first.AccessToken == "" || first.RefreshToken == "" {
+		t.Fatalf("issued pair = %+v", first)
+	}
+
+	second := rotate(t, s, first.RefreshToken)
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("rotation returned the same refresh token")
+	}
+
+	var old, next models.RefreshToken
+	db.Where("token_hash = ?", utils.HashToken(first.RefreshToken)).First(&old)
+	db.Where("token_hash = ?", utils.HashToken(second.RefreshToken)).First(&next)
+	if old.RevokedAt == nil || old.ReplacedBy == nil || *old.ReplacedBy != next.ID {
+		t.Errorf("rotated token = %+v, want it revoked and replaced by %d", old, next.ID)
+	}
+	if old.SessionID != next.SessionID {
+		t.Errorf("rotation moved to session %d from %d", next.SessionID, old.SessionID)
+	}
+
+	sessions, err := s.Sessions(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 {
+		t.Errorf("%d sessions, want 1", len(sessions))
+	}
+	rotate(t, s, second.RefreshToken)
+}
+
+func TestReusingARotatedTokenRevokesTheSession(t *testing.T) {
+	s, db, user := newService(t)
+	first := issue(t, s, user)
+	second := rotate(t, s, first.RefreshToken)
+	other := issue(t, s, user)
+
+	if _, err := s.Rotate(first.RefreshToken); !errors.Is(err, tokens.ErrTokenReuse) {
+		t.Fatalf("reuse: err = %v, want ErrTokenReuse", err)
+	}
+
+	// The thief's and the owner's latest tokens both stop working
+	if _, err := s.Rotate(second.RefreshToken); !errors.Is(err, tokens.ErrInvalidToken) {
+		t.Errorf("latest token after reuse: err = %v, want ErrInvalidToken", err)
+	}
+	var current models.RefreshToken
+	db.Where("token_hash = ?", utils.HashToken(second.RefreshToken)).First(&current)
+	if active, _ := s.SessionActive(current.SessionID); active {
+		t.Error("session still active after reuse")
+	}
+
+	// Other sessions are left alone
+	rotate(t, s, other.RefreshToken)
+}
+
+func TestRotateRejectsInvalidTokens(t *testing.T) {
+	s, db, user := newService(t)
+
+	if _, err := s.Rotate("made-up"); !errors.Is(err, tokens.ErrInvalidToken) {
+		t.Errorf("unknown token: err = %v, want ErrInvalidToken", err)
+	}
+
+	expired := issue(t, s, user)
+	db.Model(&models.RefreshToken{}).Where("token_hash = ?", utils.HashToken(expired.RefreshToken)).
+		Update("expires_at", time.Now().Add(-time.Second))
+	if _, err := s.Rotate(expired.RefreshToken); !errors.Is(err, tokens.ErrInvalidToken) {
+		t.Errorf("expired token: err = %v, want ErrInvalidToken", err)
+	}
+
+	revoked := issue(t, s, user)
+	if err := s.Revoke(revoked.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Rotate(revoked.RefreshToken); !errors.Is(err, tokens.ErrInvalidToken) {
+		t.Errorf("revoked token: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestDeactivatedAccountsGetNoTokens(t *testing.T) {
+	s, db, user := newService(t)
+	pair := issue(t, s, user)
+
+	if err := db.Model(&user).Update("status", models.UserDeactivated).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Issue(user, tokens.Client{}); !errors.Is(err, tokens.ErrAccountDeactivated) {
+		t.Errorf("issue: err = %v, want ErrAccountDeactivated", err)
+	}
+	if _, err := s.Rotate(pair.RefreshToken); !errors.Is(err, tokens.ErrAccountDeactivated) {
+		t.Errorf("rotate: err = %v, want ErrAccountDeactivated", err)
+	}
+}
+
+func TestRevokeOthersKeepsTheCurrentSession(t *testing.T) {
+	s, db, user := newService(t)
+	current := issue(t, s, user)
+	other := issue(t, s, user)
+
+	var token models.RefreshToken
+	db.Where("token_hash = ?", utils.HashToken(current.RefreshToken)).First(&token)
+	if err := s.RevokeOthers(user.ID, token.SessionID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Rotate(other.RefreshToken); !errors.Is(err, tokens.ErrInvalidToken) {
+		t.Errorf("other session: err = %v, want ErrInvalidToken", err)
+	}
+	rotate(t, s, current.RefreshToken)
+
+	if err := s.RevokeAll(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, _ := s.Sessions(user.ID); len(sessions) != 0 {
+		t.Errorf("%d sessions left after RevokeAll", len(sessions))
+	}
+}
+
+func TestRevokeSessionChecksTheOwner(t *testing.T) {
+	s, db, user := newService(t)
+	pair := issue(t, s, user)
+	var token models.RefreshToken
+	db.Where("token_hash = ?", utils.HashToken(pair.RefreshToken)).First(&token)
+
+	if err := s.RevokeSession(user.ID+1, token.SessionID); !errors.Is(err, tokens.ErrSessionNotFound) {
+		t.Errorf("someone else's session: err = %v, want ErrSessionNotFound", err)
+	}
+	if err := s.RevokeSession(user.ID, token.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if active, _ := s.SessionActive(token.SessionID); active {
+		t.Error("session still active after RevokeSession")
+	}
+}
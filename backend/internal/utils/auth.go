@@ -5,10 +5,10 @@ import(
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 
 )
-var jwtSecret=[]byte("abcd")
 func HashPassword(password string)(string,error){
 	bytes,err:= bcrypt.GenerateFromPassword([] byte(password),14)
 	return string(bytes),err
@@ -19,22 +19,25 @@ func CheckPasswordHash(password,hash string)bool{
 	return err==nil
 }
 
-func GenerateJWT(userID uint, roles [] string) (string, error){
-	token:= jwt.NewWithClaims(jwt.SigningMethodHS256,jwt.MapClaims{
-		"userId":userID,
+// GenerateJWT issues an access token bound to a login session so the
+// middleware can reject it as soon as that session is revoked.
+func GenerateJWT(userID uint, roles [] string, sessionID uint, ttl time.Duration) (string, error){
+	key, err := signingKey()
+	if err != nil {
+		return "", err
+	}
+	token:= jwt.NewWithClaims(key.Method,jwt.MapClaims{
+		"user_id":userID,
 		"roles":roles,
-		"exp":time.Now().Add(time.Hour*24).Unix(),
+		"sid":sessionID,
+		"exp":time.Now().Add(ttl).Unix(),
 	})
-	return token.SignedString(jwtSecret)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
 }
 
 func ParseJWT(tokenString string) (*jwt.Token, error) {
-   return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-	  if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-		 return nil, jwt.ErrSignatureInvalid
-	  }
-	  return jwtSecret, nil
-   })
+   return jwt.Parse(tokenString, verificationKey)
 }
 
 func GenerateVerificationToken() (string, error) {
@@ -44,3 +47,9 @@ func GenerateVerificationToken() (string, error) {
 	}
 	return hex.EncodeToString(b), nil
 }
+
+// HashToken returns the SHA-256 hex digest used to store random tokens at rest.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,295 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one entry of the key set. Private is nil for verify-only keys
+// that are kept around after rotation until their tokens have expired.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private interface{} // []byte for HMAC, crypto.Signer otherwise
+	Public  interface{} // []byte for HMAC, crypto.PublicKey otherwise
+}
+
+// KeySet holds the key new tokens are signed with and every key that tokens
+// may still be verified with, indexed by their "kid".
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// minSecretLength is the shortest HMAC secret accepted, matching the output
+// size of HS256.
+const minSecretLength = 32
+
+// errNoSigningKey is returned when tokens are issued or verified before
+// LoadSigningKeys has configured a key.
+var errNoSigningKey = errors.New("no JWT signing key configured")
+
+var (
+	keySetMu sync.RWMutex
+	keySet   = &KeySet{keys: map[string]*SigningKey{}}
+)
+
+// devKeySet signs with a random secret generated at startup, so tokens do not
+// survive a restart and there is no well-known key to forge them with.
+func devKeySet() (*KeySet, error) {
+	secret := make([]byte, minSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	key := &SigningKey{ID: "dev", Method: jwt.SigningMethodHS256, Private: secret, Public: secret}
+	return &KeySet{active: key, keys: map[string]*SigningKey{key.ID: key}}, nil
+}
+
+func currentKeySet() *KeySet {
+	keySetMu.RLock()
+	defer keySetMu.RUnlock()
+	return keySet
+}
+
+// LoadSigningKeys configures JWT keys from the environment:
+//
+//	JWT_KEYS   comma-separated "kid:alg:path" entries, e.g.
+//	           "2025-01:RS256:/keys/2025-01.pem,2024-07:RS256:/keys/2024-07.pub.pem".
+//	           The first entry signs new tokens; all entries verify. For HS*
+//	           the file holds the shared secret; otherwise a PEM private key,
+//	           or a PEM public key for verify-only (retired) keys.
+//	JWT_SECRET shared HS256 secret of at least 32 bytes, used when JWT_KEYS
+//	           is not set.
+//
+// Without either variable LoadSigningKeys fails, unless JWT_DEV_KEY=true
+// asks for a throwaway key for local development.
+func LoadSigningKeys() error {
+	spec := strings.TrimSpace(os.Getenv("JWT_KEYS"))
+	if spec == "" {
+		if secret := os.Getenv("JWT_SECRET"); secret != "" {
+			if len(secret) < minSecretLength {
+				return fmt.Errorf("JWT_SECRET must be at least %d bytes", minSecretLength)
+			}
+			key := &SigningKey{ID: "default", Method: jwt.SigningMethodHS256, Private: []byte(secret), Public: []byte(secret)}
+			setKeySet(&KeySet{active: key, keys: map[string]*SigningKey{key.ID: key}})
+			return nil
+		}
+		if os.Getenv("JWT_DEV_KEY") != "true" {
+			return errors.New("set JWT_KEYS or JWT_SECRET, or JWT_DEV_KEY=true for local development")
+		}
+		ks, err := devKeySet()
+		if err != nil {
+			return err
+		}
+		log.Println("Warning: JWT_KEYS and JWT_SECRET are not set; signing with a temporary development key")
+		setKeySet(ks)
+		return nil
+	}
+
+	ks := &KeySet{keys: make(map[string]*SigningKey)}
+	for i, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) != 3 {
+			return fmt.Errorf("invalid JWT_KEYS entry %q: want kid:alg:path", entry)
+		}
+		key, err := loadSigningKey(parts[0], parts[1], parts[2])
+		if err != nil {
+			return fmt.Errorf("loading key %q: %w", parts[0], err)
+		}
+		if _, exists := ks.keys[key.ID]; exists {
+			return fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		if i == 0 {
+			if key.Private == nil {
+				return fmt.Errorf("active key %q has no private key", key.ID)
+			}
+			ks.active = key
+		}
+		ks.keys[key.ID] = key
+	}
+
+	setKeySet(ks)
+	return nil
+}
+
+func setKeySet(ks *KeySet) {
+	keySetMu.Lock()
+	defer keySetMu.Unlock()
+	keySet = ks
+}
+
+func loadSigningKey(kid, alg, path string) (*SigningKey, error) {
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{ID: kid, Method: method}
+
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		secret := []byte(strings.TrimSpace(string(data)))
+		if len(secret) < minSecretLength {
+			return nil, fmt.Errorf("HMAC secret must be at least %d bytes", minSecretLength)
+		}
+		key.Private, key.Public = secret, secret
+		return key, nil
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key.Public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		var private *rsa.PrivateKey
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err == nil {
+			key.Private, key.Public = private, private.Public()
+		}
+	case "EC PRIVATE KEY":
+		var private *ecdsa.PrivateKey
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+		if err == nil {
+			key.Private, key.Public = private, private.Public()
+		}
+	case "PRIVATE KEY":
+		var private interface{}
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			signer, ok := private.(crypto.Signer)
+			if !ok {
+				return nil, errors.New("unsupported private key type")
+			}
+			key.Private, key.Public = signer, signer.Public()
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !keyMatchesMethod(key.Public, method) {
+		return nil, fmt.Errorf("key type does not match algorithm %s", alg)
+	}
+	return key, nil
+}
+
+func keyMatchesMethod(public interface{}, method jwt.SigningMethod) bool {
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := public.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		_, ok := public.(*ecdsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodEd25519:
+		_, ok := public.(ed25519.PublicKey)
+		return ok
+	}
+	return false
+}
+
+// signingKey returns the active key used to sign new tokens.
+func signingKey() (*SigningKey, error) {
+	key := currentKeySet().active
+	if key == nil {
+		return nil, errNoSigningKey
+	}
+	return key, nil
+}
+
+// verificationKey looks up the key named by the token's "kid" header and
+// checks that the token uses that key's algorithm. Tokens without a "kid"
+// are verified with the active key.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	ks := currentKeySet()
+
+	key := ks.active
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = ks.keys[kid]; !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+	}
+	if key == nil {
+		return nil, errNoSigningKey
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.Public, nil
+}
+
+// JWK is the JSON Web Key representation of a public verification key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// PublicJWKS returns the public keys of the key set. Shared HMAC secrets are
+// never published, so a pure HS256 deployment yields an empty set.
+func PublicJWKS() []JWK {
+	ks := currentKeySet()
+
+	jwks := make([]JWK, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64URL(public.N.Bytes())
+			jwk.E = base64URL(big.NewInt(int64(public.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (public.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = public.Curve.Params().Name
+			jwk.X = base64URL(public.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64URL(public.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64URL(public)
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+	return jwks
+}
+
+func base64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
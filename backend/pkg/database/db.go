@@ -17,10 +17,70 @@ func ConnectDB() {
 	}
 	
 	DB = db
-	
+
+	// Books are split into copies once, when the copies table is created
+	splitCopies := !DB.Migrator().HasTable(&models.Copy{})
+
 	// Auto migrate models
-	err = DB.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.Book{}, &models.Category{}, &models.Loan{})
+	err = DB.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.Book{}, &models.Category{}, &models.Copy{}, &models.Loan{}, &models.AuditLog{}, &models.Session{}, &models.RefreshToken{}, &models.RecoveryCode{}, &models.MFAChallenge{}, &models.ExternalIdentity{}, &models.APIKey{}, &models.PasswordHistory{}, &models.OneTimeToken{}, &models.EmailChange{})
 	if err != nil {
 		log.Fatal("Failed to migrate database")
 	}
+
+	// Several editions may share a title; the ISBN identifies a book
+	if DB.Migrator().HasConstraint(&models.Book{}, "uni_books_title") {
+		if err := DB.Migrator().DropConstraint(&models.Book{}, "uni_books_title"); err != nil {
+			log.Fatalf("Failed to drop the unique book title constraint: %v", err)
+		}
+	}
+
+	// Before copies existed, every book was a single physical copy. Give
+	// each book that was not UNAVAILABLE one copy with a barcode derived from
+	// its ID, and point its loans at that copy
+	if splitCopies {
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			for _, statement := range []string{
+				`INSERT INTO copies (created_at, updated_at, deleted_at, book_id, barcode, condition, status)
+				SELECT NOW(), NOW(), deleted_at, id, 'B' || LPAD(id::text, 9, '0'), 'GOOD', status
+				FROM books
+				WHERE status IN ('AVAILABLE', 'CHECKED_OUT', 'RESERVED')`,
+				`UPDATE loans SET copy_id = copies.id FROM copies WHERE copies.book_id = loans.book_id`,
+			} {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("Failed to create copies of existing books: %v", err)
+		}
+	}
+
+	// Book search: Postgres keeps a weighted document of title, author and
+	// description up to date, and trigram indexes serve typo-tolerant matches
+	for _, statement := range []string{
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('english', coalesce(author, '')), 'B') ||
+			setweight(to_tsvector('english', coalesce(description, '')), 'C')
+		) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_books_search_vector ON books USING GIN (search_vector)`,
+		`CREATE INDEX IF NOT EXISTS idx_books_title_trgm ON books USING GIN (title gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_books_author_trgm ON books USING GIN (author gin_trgm_ops)`,
+	} {
+		if err := DB.Exec(statement).Error; err != nil {
+			log.Fatalf("Failed to set up book search: %v", err)
+		}
+	}
+
+	// Verification and reset tokens used to be stored in plaintext on users
+	for _, column := range []string{"verify_token", "verify_expiry", "reset_token", "reset_expiry"} {
+		if DB.Migrator().HasColumn(&models.User{}, column) {
+			if err := DB.Migrator().DropColumn(&models.User{}, column); err != nil {
+				log.Fatalf("Failed to drop users.%s: %v", column, err)
+			}
+		}
+	}
 }
\ No newline at end of file
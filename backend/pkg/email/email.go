@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net/smtp"
+	"time"
 )
 
 type Config struct {
@@ -22,20 +23,9 @@ func NewService(cfg Config) *Service {
 }
 
 func (s *Service) SendVerificationEmail(to, token string) error {
-	// Email content
-	subject := "Subject: Verify Your Email\r\n"
 	body := fmt.Sprintf("Click this link to verify your account: http://localhost:8080/auth/verify-email?token=%s\r\n", token)
-	msg := []byte(subject + "\r\n" + body)
-
-	// SMTP auth
-	auth := smtp.PlainAuth("", s.config.From, s.config.Password, s.config.SmtpHost)
-
-	// Send email
-	addr := fmt.Sprintf("%s:%s", s.config.SmtpHost, s.config.SmtpPort)
-	fmt.Println(addr)
-	err := smtp.SendMail(addr, auth, s.config.From, []string{to}, msg)
-	if err != nil {
-		return fmt.Errorf("failed to send email: %v", err)
+	if err := s.send(to, "Verify Your Email", body); err != nil {
+		return err
 	}
 
 	log.Printf("Verification email sent to %s", to)
@@ -43,22 +33,71 @@ func (s *Service) SendVerificationEmail(to, token string) error {
 }
 
 func (s *Service) SendResetPasswordEmail(to, token string) error {
-	// Email content
-	subject := "Subject: Reset Your Password\r\n"
 	body := fmt.Sprintf("Click this link to reset your password: http://localhost:8080/auth/reset-password?token=%s\r\n", token)
-	msg := []byte(subject + "\r\n" + body)
+	if err := s.send(to, "Reset Your Password", body); err != nil {
+		return err
+	}
+
+	log.Printf("Reset password email sent to %s", to)
+	return nil
+}
+
+func (s *Service) SendMagicLinkEmail(to, token string, ttl time.Duration) error {
+	body := fmt.Sprintf("Click this link to sign in: http://localhost:8080/auth/magic-link/verify?token=%s\r\n"+
+		"The link can be used once and expires in %d minutes. If you didn't ask to sign in, ignore this email.\r\n",
+		token, int(ttl.Minutes()))
+	if err := s.send(to, "Your Sign-In Link", body); err != nil {
+		return err
+	}
+
+	log.Printf("Magic link email sent to %s", to)
+	return nil
+}
+
+func (s *Service) SendEmailChangeConfirmation(to, token string) error {
+	body := fmt.Sprintf("Click this link to confirm your new email address: http://localhost:8080/auth/email-change/confirm?token=%s\r\n", token)
+	if err := s.send(to, "Confirm Your New Email Address", body); err != nil {
+		return err
+	}
+
+	log.Printf("Email change confirmation sent to %s", to)
+	return nil
+}
+
+func (s *Service) SendEmailChangeNotice(to, newEmail string) error {
+	body := fmt.Sprintf("A change of your account's email address to %s was requested. "+
+		"It takes effect once confirmed from the new address. If this wasn't you, reset your password.\r\n", newEmail)
+	if err := s.send(to, "Your Email Address Is Being Changed", body); err != nil {
+		return err
+	}
+
+	log.Printf("Email change notice sent to %s", to)
+	return nil
+}
+
+func (s *Service) SendAccountLockedEmail(to string, until time.Time) error {
+	body := fmt.Sprintf("Your account was temporarily locked after repeated failed login attempts. "+
+		"You can try again after %s. If this wasn't you, reset your password.\r\n", until.Format(time.RFC1123))
+	if err := s.send(to, "Your Account Has Been Locked", body); err != nil {
+		return err
+	}
+
+	log.Printf("Account locked email sent to %s", to)
+	return nil
+}
+
+// send delivers a plain-text email through the configured SMTP server
+func (s *Service) send(to, subject, body string) error {
+	msg := []byte("Subject: " + subject + "\r\n\r\n" + body)
 
 	// SMTP auth
 	auth := smtp.PlainAuth("", s.config.From, s.config.Password, s.config.SmtpHost)
 
 	// Send email
 	addr := fmt.Sprintf("%s:%s", s.config.SmtpHost, s.config.SmtpPort)
-	fmt.Println(addr)
 	err := smtp.SendMail(addr, auth, s.config.From, []string{to}, msg)
 	if err != nil {
 		return fmt.Errorf("failed to send email: %v", err)
 	}
-
-	log.Printf("Reset password email sent to %s", to)
 	return nil
 }